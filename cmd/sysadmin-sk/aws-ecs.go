@@ -31,5 +31,21 @@ func NewAwsEcsCommand() *cobra.Command {
 
 	cmd.ResetFlags()
 	cmd.AddCommand(ecsLibrary.ListCommand())
+	cmd.AddCommand(ecsLibrary.DeployCommand())
+	cmd.AddCommand(ecsLibrary.RollbackCommand())
+	cmd.AddCommand(ecsLibrary.DiffTaskDefinitionCommand())
+	cmd.AddCommand(ecsLibrary.EventsCommand())
+	cmd.AddCommand(ecsLibrary.ScaleCommand())
+	cmd.AddCommand(ecsLibrary.RestartCommand())
+	cmd.AddCommand(ecsLibrary.PruneTaskDefinitionsCommand())
+	cmd.AddCommand(ecsLibrary.CapacityCommand())
+	cmd.AddCommand(ecsLibrary.DrainCommand())
+	cmd.AddCommand(ecsLibrary.RunCommand())
+	cmd.AddCommand(ecsLibrary.CheckCommand())
+	cmd.AddCommand(ecsLibrary.ExportCommand())
+	cmd.AddCommand(ecsLibrary.AuditCommand())
+	cmd.AddCommand(ecsLibrary.ImagesCommand())
+	cmd.AddCommand(ecsLibrary.ToK8sCommand())
+	cmd.AddCommand(ecsLibrary.ListScheduledCommand())
 	return cmd
 }
@@ -0,0 +1,67 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/config"
+)
+
+// globalOptions defines the flags available to every sysadmin-sk command
+type globalOptions struct {
+
+	// Path to the configuration file
+	configPath string `type:"string" required:"false"`
+
+	// Named environment, from the configuration file, to fill in the flags with
+	env string `type:"string" required:"false"`
+}
+
+// addGlobalFlags registers the global flags on the root command and loads the
+// configuration file before running any of its sub-commands.
+func addGlobalFlags(cmd *cobra.Command) {
+	var options globalOptions
+
+	cmd.PersistentFlags().StringVarP(&options.configPath, "config", "", config.DefaultPath(), "Path to the sysadmin-sk configuration file")
+	cmd.PersistentFlags().StringVarP(&options.env, "env", "", os.Getenv("SYSADMIN_SK_ENV"), "Named environment from the configuration file (default: $SYSADMIN_SK_ENV)")
+
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd, &options)
+	}
+}
+
+// applyConfig fills in the command flags from the configuration file
+func applyConfig(cmd *cobra.Command, options *globalOptions) error {
+	cfg, err := config.Load(options.configPath)
+	if err != nil {
+		return err
+	}
+
+	var env *config.Environment
+	if options.env != "" {
+		env, err = cfg.Environment(options.env)
+		if err != nil {
+			return err
+		}
+	}
+
+	config.SetCurrent(cfg, env)
+	return cfg.Apply(cmd, env)
+}
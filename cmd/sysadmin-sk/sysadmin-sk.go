@@ -17,8 +17,13 @@
 package main
 
 import (
+	"errors"
+	"os"
+
 	"github.com/lithammer/dedent"
 	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/utils"
 )
 
 func main() {
@@ -35,10 +40,20 @@ func main() {
 	}
 
 	cmd.ResetFlags()
+	addGlobalFlags(cmd)
+
 	cmd.AddCommand(NewVersionCommand())
 	cmd.AddCommand(NewAwsSqsCommand())
 	cmd.AddCommand(NewAwsEcsCommand())
 	cmd.AddCommand(NewAwsEcrCommand())
 	cmd.AddCommand(NewK8sCommand())
-	cmd.Execute()
+	cmd.AddCommand(NewAuditCommand())
+
+	if err := cmd.Execute(); err != nil {
+		var exitErr *utils.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		os.Exit(1)
+	}
 }
@@ -3,7 +3,7 @@ module github.com/raffs/sysadmin-sk
 go 1.16
 
 require (
-	github.com/aws/aws-sdk-go v1.26.8
+	github.com/aws/aws-sdk-go v1.44.332
 	github.com/google/gofuzz v1.2.0 // indirect
 	github.com/googleapis/gnostic v0.5.5 // indirect
 	github.com/gregjones/httpcache v0.0.0-20190611155906-901d90724c79 // indirect
@@ -11,10 +11,12 @@ require (
 	github.com/lithammer/dedent v1.1.0
 	github.com/peterbourgon/diskv v2.0.1+incompatible // indirect
 	github.com/spf13/cobra v0.0.5
-	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/oauth2 v0.0.0-20210628180205-a41e5a781914 // indirect
 	golang.org/x/time v0.0.0-20210611083556-38a9dc6acbc6 // indirect
+	k8s.io/api v0.20.2
 	k8s.io/apimachinery v0.21.2
 	k8s.io/client-go v0.20.2
 	k8s.io/klog v1.0.0 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
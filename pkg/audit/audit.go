@@ -0,0 +1,262 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package audit keeps a local record, as JSON lines, of every operation that
+// changes something, optionally forwarding each record to a webhook.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/raffs/sysadmin-sk/pkg/config"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+)
+
+// the result of an audited operation
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultAborted = "aborted"
+	ResultDryRun  = "dry-run"
+)
+
+// the value written in place of the secrets
+const redacted = "***"
+
+// sensitiveFlag matches the flags whose value may be a secret, e.g: --container-env
+var sensitiveFlag = regexp.MustCompile(`(?i)^--?[a-z0-9-]*(env|secret|token|password)[a-z0-9-]*$`)
+
+// variable matches the KEY=VALUE arguments, e.g: an environment variable
+var variable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// Target describes where an operation made its changes
+type Target struct {
+	Account   string `json:"account,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+	Context   string `json:"context,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Record is one audited operation
+type Record struct {
+	Time        time.Time        `json:"time"`
+	User        string           `json:"user"`
+	Host        string           `json:"host"`
+	Command     string           `json:"command"`
+	Args        []string         `json:"args"`
+	Environment string           `json:"environment,omitempty"`
+	Target      Target           `json:"target"`
+	DryRun      bool             `json:"dryRun,omitempty"`
+	Result      string           `json:"result"`
+	Error       string           `json:"error,omitempty"`
+	Counts      map[string]int64 `json:"counts,omitempty"`
+	Duration    string           `json:"duration"`
+}
+
+// DefaultPath returns the default location of the audit log
+func DefaultPath() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "sysadmin-sk", "audit.log")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".local", "state", "sysadmin-sk", "audit.log")
+}
+
+// Start begins the record of an operation for the given command (e.g: "aws-sqs move")
+func Start(command string) *Record {
+	record := &Record{
+		Time:    time.Now().UTC(),
+		Command: command,
+		Args:    redactArgs(os.Args[1:]),
+		Counts:  make(map[string]int64),
+	}
+
+	if env := config.Current(); env != nil {
+		record.Environment = env.Name
+	}
+
+	if u, err := user.Current(); err == nil {
+		record.User = u.Username
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		record.Host = host
+	}
+
+	return record
+}
+
+// redactArgs returns the command line arguments without the values which may be
+// secrets: the values of the sensitive flags and of the KEY=VALUE arguments.
+func redactArgs(args []string) []string {
+	redactedArgs := make([]string, 0, len(args))
+	redactNext := false
+
+	for _, arg := range args {
+		switch {
+		case redactNext:
+			arg = redacted
+			redactNext = false
+		case strings.HasPrefix(arg, "-") && strings.Contains(arg, "="):
+			i := strings.Index(arg, "=")
+			if sensitiveFlag.MatchString(arg[:i]) {
+				arg = arg[:i+1] + redacted
+			}
+		case sensitiveFlag.MatchString(arg):
+			redactNext = true
+		case variable.MatchString(arg):
+			arg = arg[:strings.Index(arg, "=")+1] + redacted
+		}
+
+		redactedArgs = append(redactedArgs, arg)
+	}
+
+	return redactedArgs
+}
+
+// Add increases one of the result counts of the operation (e.g: "deleted")
+func (r *Record) Add(name string, n int64) {
+	r.Counts[name] += n
+}
+
+// Finish completes the record with the operation result and writes it down.
+// Failing to write the record does not fail the operation, a warning is printed.
+func (r *Record) Finish(err error) {
+	r.Duration = time.Since(r.Time).Round(time.Millisecond).String()
+
+	switch {
+	case err == guard.ErrAborted:
+		r.Result = ResultAborted
+	case err != nil:
+		r.Result = ResultFailure
+		r.Error = err.Error()
+	case r.DryRun:
+		r.Result = ResultDryRun
+	default:
+		r.Result = ResultSuccess
+	}
+
+	settings := config.Loaded().Audit
+	if settings.Disabled {
+		return
+	}
+
+	content, jsonErr := json.Marshal(r)
+	if jsonErr != nil {
+		fmt.Fprintln(os.Stderr, "WARN: unable to write the audit record:", jsonErr.Error())
+		return
+	}
+
+	if writeErr := appendLine(path(), content); writeErr != nil {
+		fmt.Fprintln(os.Stderr, "WARN: unable to write the audit record:", writeErr.Error())
+	}
+
+	if settings.Webhook != "" {
+		if postErr := post(settings.Webhook, content); postErr != nil {
+			fmt.Fprintln(os.Stderr, "WARN: unable to send the audit record to the webhook:", postErr.Error())
+		}
+	}
+}
+
+// Read returns the records written since the given time, oldest first
+func Read(since time.Time) ([]*Record, error) {
+	file, err := os.Open(path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			fmt.Fprintln(os.Stderr, "WARN: skipping invalid audit record:", err.Error())
+			continue
+		}
+
+		if !record.Time.Before(since) {
+			records = append(records, &record)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+func path() string {
+	if p := config.Loaded().Audit.Path; p != "" {
+		return p
+	}
+
+	return DefaultPath()
+}
+
+func appendLine(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(content, '\n'))
+	return err
+}
+
+func post(url string, content []byte) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	response, err := client.Post(url, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "nothing to redact",
+			args: []string{"aws-ecs", "scale", "prod", "api", "--count", "4"},
+			want: []string{"aws-ecs", "scale", "prod", "api", "--count", "4"},
+		},
+		{
+			name: "sensitive flag followed by its value",
+			args: []string{"aws-ecs", "run", "prod", "api", "--container-env", "DB_PASSWORD=hunter2", "--yes"},
+			want: []string{"aws-ecs", "run", "prod", "api", "--container-env", "***", "--yes"},
+		},
+		{
+			name: "sensitive flag with an equal sign",
+			args: []string{"--container-env=DB_PASSWORD=hunter2", "--api-token=abc", "--count=4"},
+			want: []string{"--container-env=***", "--api-token=***", "--count=4"},
+		},
+		{
+			name: "flag names are case insensitive",
+			args: []string{"--Secret", "abc", "--PASSWORD-file=/tmp/password"},
+			want: []string{"--Secret", "***", "--PASSWORD-file=***"},
+		},
+		{
+			name: "KEY=VALUE arguments",
+			args: []string{"aws-ecs", "run", "prod", "api", "--", "env", "API_KEY=abc", "./migrate"},
+			want: []string{"aws-ecs", "run", "prod", "api", "--", "env", "API_KEY=***", "./migrate"},
+		},
+		{
+			name: "filter expressions keep their tags",
+			args: []string{"--filter", "tag:team=payments"},
+			want: []string{"--filter", "tag:team=payments"},
+		},
+		{
+			name: "sensitive flag last",
+			args: []string{"aws-ecs", "run", "--container-env"},
+			want: []string{"aws-ecs", "run", "--container-env"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := redactArgs(test.args); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("redactArgs() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
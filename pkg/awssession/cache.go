@@ -0,0 +1,139 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package awssession
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+)
+
+// refresh the assumed role credentials a bit before they actually expire, so a
+// long running command does not fail half-way with ExpiredTokenException.
+const expiryWindow = 1 * time.Minute
+
+// cachedCredentials is the on-disk representation of assumed role credentials
+type cachedCredentials struct {
+	AccessKeyID     string    `json:"accessKeyId"`
+	SecretAccessKey string    `json:"secretAccessKey"`
+	SessionToken    string    `json:"sessionToken"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// cachedProvider wraps the assume role provider and keeps the credentials on
+// disk, so the MFA token is not prompted again on every invocation.
+type cachedProvider struct {
+	credentials.Expiry
+
+	path     string
+	provider *stscreds.AssumeRoleProvider
+}
+
+// Retrieve returns the cached credentials when still valid, otherwise assume
+// the role again and refresh the cache.
+func (p *cachedProvider) Retrieve() (credentials.Value, error) {
+	if cached, err := readCache(p.path); err == nil && time.Now().Add(expiryWindow).Before(cached.Expiration) {
+		p.SetExpiration(cached.Expiration, expiryWindow)
+		return credentials.Value{
+			AccessKeyID:     cached.AccessKeyID,
+			SecretAccessKey: cached.SecretAccessKey,
+			SessionToken:    cached.SessionToken,
+			ProviderName:    stscreds.ProviderName,
+		}, nil
+	}
+
+	value, err := p.provider.Retrieve()
+	if err != nil {
+		return value, err
+	}
+
+	// the provider already took the expiry window off
+	expiration := p.provider.ExpiresAt().Add(expiryWindow)
+	p.SetExpiration(expiration, expiryWindow)
+
+	err = writeCache(p.path, &cachedCredentials{
+		AccessKeyID:     value.AccessKeyID,
+		SecretAccessKey: value.SecretAccessKey,
+		SessionToken:    value.SessionToken,
+		Expiration:      expiration,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "WARN: unable to cache the assumed role credentials:", err.Error())
+	}
+
+	return value, nil
+}
+
+// roleCacheKey identifies an assumed role session, regardless of the region
+func roleCacheKey(options *Options) string {
+	return strings.Join([]string{
+		options.Profile,
+		options.RoleArn,
+		roleSessionName(options),
+		options.ExternalID,
+		options.MFASerial,
+		options.RoleDuration.String(),
+	}, "|")
+}
+
+// cachePath returns where the credentials for the given key are stored
+func cachePath(key string) string {
+	sum := sha1.Sum([]byte(key))
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "sysadmin-sk", "aws", hex.EncodeToString(sum[:])+".json")
+}
+
+func readCache(path string) (*cachedCredentials, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedCredentials
+	if err := json.Unmarshal(content, &cached); err != nil {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+func writeCache(path string, cached *cachedCredentials) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0600)
+}
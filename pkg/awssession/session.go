@@ -0,0 +1,227 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package awssession builds the AWS sessions shared by every aws-* command, so
+// profiles, assume-role and MFA behave the same way no matter the service.
+package awssession
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/pflag"
+)
+
+// Options defines how to connect and authenticate against the AWS API
+type Options struct {
+
+	// Define which AWS region to connect to the service
+	Region string `type:"string" required:"false"`
+
+	// Define the AWS API endpoint. Usually this is use for lower-level API call
+	// and for testing and/or mocking.
+	Endpoint string `type:"string" required:"false"`
+
+	// Define the AWS profile, as found on the shared config and credentials files
+	Profile string `type:"string" required:"false"`
+
+	// Role to assume on top of the profile (or default) credentials
+	RoleArn string `type:"string" required:"false"`
+
+	// Name of the assumed role session, shown on CloudTrail. Defaults to sysadmin-sk-<user>
+	RoleSessionName string `type:"string" required:"false"`
+
+	// External ID required by the trust policy of the assumed role
+	ExternalID string `type:"string" required:"false"`
+
+	// Serial number (or ARN) of the MFA device. When set, the token is prompted on the terminal
+	MFASerial string `type:"string" required:"false"`
+
+	// How long the assumed role credentials are valid for
+	RoleDuration time.Duration `type:"duration" required:"false"`
+
+	// Whether to skip the on-disk cache of assumed role credentials
+	NoCredentialCache bool `type:"bool" required:"false"`
+}
+
+var (
+	// sessions already created by this process, so commands fanning out over the
+	// same options do not prompt for MFA tokens more than once.
+	sessionsMu sync.Mutex
+	sessions   = make(map[Options]*session.Session)
+
+	// assumed role credentials, shared by the sessions of every region
+	roles = make(map[string]*credentials.Credentials)
+
+	invalidSessionChars = regexp.MustCompile(`[^\w+=,.@-]`)
+)
+
+// AddFlags registers the AWS connection flags on the given flag set
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.Region, "aws-region", "r", "", "define AWS region.")
+	flags.StringVarP(&o.Profile, "aws-profile", "p", "", "define AWS profile")
+	flags.StringVarP(&o.Endpoint, "aws-endpoint", "e", "", "Define the AWS API endpoint (usually for low-level and testing")
+	flags.StringVarP(&o.RoleArn, "role-arn", "", "", "ARN of the IAM role to assume before calling AWS")
+	flags.StringVarP(&o.RoleSessionName, "role-session-name", "", "", "Name of the assumed role session (default: sysadmin-sk-<user>)")
+	flags.StringVarP(&o.ExternalID, "external-id", "", "", "External ID to pass when assuming the role")
+	flags.StringVarP(&o.MFASerial, "mfa-serial", "", "", "Serial number or ARN of the MFA device, the token code is prompted")
+	flags.DurationVarP(&o.RoleDuration, "role-duration", "", stscreds.DefaultDuration, "How long the assumed role credentials are valid for")
+	flags.BoolVarP(&o.NoCredentialCache, "no-credential-cache", "", false, "Do not read or write cached assumed role credentials")
+}
+
+// New returns an AWS session for the given options. Sessions are cached for the
+// lifetime of the process, so it's cheap to call it once per client.
+func New(options *Options) (*session.Session, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	if sess, ok := sessions[*options]; ok {
+		return sess, nil
+	}
+
+	sessionOpts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           options.Profile,
+
+		// used when the profile itself assumes a role protected by MFA
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+
+		// aws configuration
+		Config: aws.Config{
+			Region:   aws.String(options.Region),
+			Endpoint: aws.String(options.Endpoint),
+		},
+	}
+
+	sess, err := session.NewSessionWithOptions(sessionOpts)
+	if err != nil {
+		fmt.Println("Unable to create new session with AWS with error: ", err.Error())
+		return nil, errors.New("Unable to initialize AWS session")
+	}
+
+	if options.RoleArn != "" {
+		key := roleCacheKey(options)
+		if _, ok := roles[key]; !ok {
+			roles[key] = roleCredentials(sess, options)
+		}
+
+		sess = sess.Copy(&aws.Config{Credentials: roles[key]})
+	}
+
+	sessions[*options] = sess
+	return sess, nil
+}
+
+// InRegion returns a copy of the options pointing to another region, used by the
+// commands fanning out over several regions.
+func (o Options) InRegion(region string) *Options {
+	if region != "" {
+		o.Region = region
+	}
+
+	return &o
+}
+
+// roleCredentials returns the credentials of the assumed role, backed by the
+// on-disk cache unless it has been disabled.
+func roleCredentials(sess *session.Session, options *Options) *credentials.Credentials {
+	provider := &stscreds.AssumeRoleProvider{
+		Client:          stsClient(sess),
+		RoleARN:         options.RoleArn,
+		RoleSessionName: roleSessionName(options),
+		Duration:        options.RoleDuration,
+		ExpiryWindow:    expiryWindow,
+	}
+
+	if options.ExternalID != "" {
+		provider.ExternalID = aws.String(options.ExternalID)
+	}
+
+	if options.MFASerial != "" {
+		provider.SerialNumber = aws.String(options.MFASerial)
+		provider.TokenProvider = stscreds.StdinTokenProvider
+	}
+
+	if options.NoCredentialCache {
+		return credentials.NewCredentials(provider)
+	}
+
+	return credentials.NewCredentials(&cachedProvider{
+		path:     cachePath(roleCacheKey(options)),
+		provider: provider,
+	})
+}
+
+// stsClient returns an STS client ignoring --aws-endpoint, which points to the
+// service being called (e.g: a local ECS mock) rather than to STS.
+func stsClient(sess *session.Session) *sts.STS {
+	return sts.New(sess, &aws.Config{Endpoint: aws.String("")})
+}
+
+// roleSessionName returns the session name for the assumed role, defaulting to
+// sysadmin-sk-<user> so it's easy to tell who did what on CloudTrail.
+func roleSessionName(options *Options) string {
+	name := options.RoleSessionName
+	if name == "" {
+		name = "sysadmin-sk"
+		if u, err := user.Current(); err == nil && u.Username != "" {
+			name = "sysadmin-sk-" + u.Username
+		}
+	}
+
+	name = invalidSessionChars.ReplaceAllString(name, "-")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// AccountID returns the ID of the AWS account the options authenticate against
+func AccountID(options *Options) (string, error) {
+	sess, err := New(options)
+	if err != nil {
+		return "", err
+	}
+
+	identity, err := stsClient(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve the AWS account ID: %v", err)
+	}
+
+	return aws.StringValue(identity.Account), nil
+}
+
+// Region returns the region the options resolve to, either given on the command
+// line or found on the profile.
+func Region(options *Options) (string, error) {
+	sess, err := New(options)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(sess.Config.Region), nil
+}
@@ -0,0 +1,302 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package config loads the sysadmin-sk configuration file, which holds named
+// environments and per-command defaults used to fill in the command flags.
+//
+// A configuration file looks like:
+//
+//	environments:
+//	  prod:
+//	    protected: true
+//	    aws:
+//	      profile: prod
+//	      region: us-east-1
+//	    kubernetes:
+//	      context: prod-cluster
+//	      namespace: default
+//	    defaults:
+//	      aws-ecs list:
+//	        output: wide
+//
+//	defaults:
+//	  aws-sqs move:
+//	    batch-size: 5
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the content of the sysadmin-sk configuration file
+type Config struct {
+
+	// Named environments, selected with the global --env flag
+	Environments map[string]*Environment `json:"environments,omitempty"`
+
+	// Flags defaults, indexed by command (e.g: "aws-sqs move") and flag name
+	Defaults map[string]map[string]interface{} `json:"defaults,omitempty"`
+
+	// Where to record the operations which change something
+	Audit Audit `json:"audit,omitempty"`
+}
+
+// Audit defines where the audit records are written to
+type Audit struct {
+
+	// Path of the audit log, defaults to ~/.local/state/sysadmin-sk/audit.log
+	Path string `json:"path,omitempty"`
+
+	// When set, every record is also sent (HTTP POST) to this URL
+	Webhook string `json:"webhook,omitempty"`
+
+	// Whether to disable the audit log
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Environment holds all the settings used to reach one environment
+type Environment struct {
+
+	// Name of the environment, as found on the configuration file
+	Name string `json:"-"`
+
+	// Whether changes on this environment need to be confirmed by typing the
+	// AWS account ID or kubernetes context name.
+	Protected bool `json:"protected,omitempty"`
+
+	// AWS connection settings
+	AWS AWS `json:"aws,omitempty"`
+
+	// Kubernetes connection settings
+	Kubernetes Kubernetes `json:"kubernetes,omitempty"`
+
+	// Flags defaults for this environment only, they take precedence over
+	// the global defaults.
+	Defaults map[string]map[string]interface{} `json:"defaults,omitempty"`
+}
+
+// AWS defines the settings for the aws-* commands
+type AWS struct {
+	Profile    string `json:"profile,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	RoleArn    string `json:"roleArn,omitempty"`
+	ExternalID string `json:"externalId,omitempty"`
+	MFASerial  string `json:"mfaSerial,omitempty"`
+}
+
+// Kubernetes defines the settings for the k8s commands
+type Kubernetes struct {
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// the configuration and environment selected for the running command
+var (
+	loaded  = &Config{}
+	current *Environment
+)
+
+// Loaded returns the configuration loaded for the running command
+func Loaded() *Config {
+	return loaded
+}
+
+// Current returns the environment selected for the running command, nil if none
+func Current() *Environment {
+	return current
+}
+
+// SetCurrent defines the configuration and environment for the running command
+func SetCurrent(config *Config, env *Environment) {
+	loaded, current = config, env
+}
+
+// DefaultPath returns the default location of the configuration file
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "sysadmin-sk", "config.yaml")
+}
+
+// Load reads the configuration file on the given path. A missing file is not an
+// error, as the configuration file is optional, an empty configuration is returned.
+func Load(path string) (*Config, error) {
+	var config Config
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &config, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read configuration file %s: %v", path, err)
+	}
+
+	if err := yaml.UnmarshalStrict(content, &config); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s: %v", path, err)
+	}
+
+	for name, env := range config.Environments {
+		if env == nil {
+			env = &Environment{}
+			config.Environments[name] = env
+		}
+		env.Name = name
+		env.Kubernetes.Kubeconfig = expandHome(env.Kubernetes.Kubeconfig)
+	}
+	config.Audit.Path = expandHome(config.Audit.Path)
+
+	return &config, nil
+}
+
+// Environment returns the environment with the given name
+func (c *Config) Environment(name string) (*Environment, error) {
+	env, ok := c.Environments[name]
+	if !ok {
+		var names []string
+		for n := range c.Environments {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("Unknown environment '%s', available environments: [%s]", name, strings.Join(names, ", "))
+	}
+
+	return env, nil
+}
+
+// Apply fills in every flag of the command that was not given on the command
+// line, using the environment settings (when env is not nil) and the configured
+// defaults for that command.
+func (c *Config) Apply(cmd *cobra.Command, env *Environment) error {
+	values := make(map[string]string)
+	command := commandName(cmd)
+
+	mergeDefaults(values, c.Defaults[command])
+
+	if env != nil {
+		mergeDefaults(values, env.Defaults[command])
+
+		for flag, value := range env.flags() {
+			if value != "" {
+				values[flag] = value
+			}
+		}
+	}
+
+	flags := cmd.Flags()
+	for name, value := range values {
+		flag := flags.Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		if err := setFlag(flag, value); err != nil {
+			return fmt.Errorf("Invalid value '%s' for flag --%s from configuration: %v", value, name, err)
+		}
+	}
+
+	return nil
+}
+
+// flags returns the environment settings indexed by the flag they fill in
+func (e *Environment) flags() map[string]string {
+	return map[string]string{
+		"aws-profile":  e.AWS.Profile,
+		"aws-region":   e.AWS.Region,
+		"aws-endpoint": e.AWS.Endpoint,
+		"role-arn":     e.AWS.RoleArn,
+		"external-id":  e.AWS.ExternalID,
+		"mfa-serial":   e.AWS.MFASerial,
+		"kubeconfig":   e.Kubernetes.Kubeconfig,
+		"context":      e.Kubernetes.Context,
+		"namespace":    e.Kubernetes.Namespace,
+	}
+}
+
+// setFlag sets the flag value without marking it as given on the command line,
+// as the value is coming from the configuration file.
+func setFlag(flag *pflag.Flag, value string) error {
+	if err := flag.Value.Set(value); err != nil {
+		return err
+	}
+
+	// slice flags append on Set, reset them to hold the configured value only
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		return sliceValue.Replace(strings.Split(value, ","))
+	}
+
+	return nil
+}
+
+// commandName returns the command path without the root command name, which is
+// how commands are referred on the configuration file (e.g: "aws-sqs move").
+func commandName(cmd *cobra.Command) string {
+	path := strings.SplitN(cmd.CommandPath(), " ", 2)
+	if len(path) < 2 {
+		return ""
+	}
+
+	return path[1]
+}
+
+// expandHome replaces a leading ~ by the user home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+// mergeDefaults copies the configured defaults into values, as strings
+func mergeDefaults(values map[string]string, defaults map[string]interface{}) {
+	for flag, value := range defaults {
+		switch v := value.(type) {
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[flag] = strings.Join(items, ",")
+		case float64:
+			values[flag] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			values[flag] = fmt.Sprint(v)
+		}
+	}
+}
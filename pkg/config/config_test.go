@@ -0,0 +1,148 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// newMoveCommand returns a `sysadmin-sk aws-sqs move` command with a few flags
+// of different types, parsed from the given arguments.
+func newMoveCommand(t *testing.T, args ...string) *cobra.Command {
+	root := &cobra.Command{Use: "sysadmin-sk"}
+	group := &cobra.Command{Use: "aws-sqs"}
+	move := &cobra.Command{Use: "move", Run: func(*cobra.Command, []string) {}}
+
+	move.Flags().Int("batch-size", 10, "")
+	move.Flags().String("aws-region", "", "")
+	move.Flags().String("aws-profile", "", "")
+	move.Flags().StringSlice("queues", nil, "")
+	move.Flags().Bool("dry-run", false, "")
+
+	root.AddCommand(group)
+	group.AddCommand(move)
+
+	if err := move.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return move
+}
+
+func TestApply(t *testing.T) {
+	config := &Config{
+		Defaults: map[string]map[string]interface{}{
+			"aws-sqs move": {"batch-size": float64(5), "queues": []interface{}{"a", "b"}, "dry-run": true},
+			"aws-ecs list": {"batch-size": float64(99)},
+		},
+		Environments: map[string]*Environment{
+			"prod": {
+				Name: "prod",
+				AWS:  AWS{Profile: "prod", Region: "us-east-1"},
+				Defaults: map[string]map[string]interface{}{
+					"aws-sqs move": {"batch-size": float64(2)},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		env  string
+		want map[string]string
+	}{
+		{
+			name: "global defaults",
+			want: map[string]string{"batch-size": "5", "queues": "[a,b]", "dry-run": "true", "aws-region": ""},
+		},
+		{
+			name: "environment defaults and settings take precedence",
+			env:  "prod",
+			want: map[string]string{"batch-size": "2", "aws-region": "us-east-1", "aws-profile": "prod"},
+		},
+		{
+			name: "command line flags are kept",
+			args: []string{"--batch-size", "7", "--aws-region", "eu-west-1", "--queues", "c"},
+			env:  "prod",
+			want: map[string]string{"batch-size": "7", "aws-region": "eu-west-1", "queues": "[c]", "aws-profile": "prod"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := newMoveCommand(t, test.args...)
+
+			var env *Environment
+			if test.env != "" {
+				env = config.Environments[test.env]
+			}
+
+			if err := config.Apply(cmd, env); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range test.want {
+				if got := cmd.Flags().Lookup(name).Value.String(); got != want {
+					t.Errorf("--%s = %q, want %q", name, got, want)
+				}
+			}
+
+			for name := range test.want {
+				if flag := cmd.Flags().Lookup(name); flag.Changed && !contains(test.args, "--"+name) {
+					t.Errorf("--%s is marked as given on the command line", name)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyInvalidValue(t *testing.T) {
+	config := &Config{
+		Defaults: map[string]map[string]interface{}{
+			"aws-sqs move": {"batch-size": "many"},
+		},
+	}
+
+	if err := config.Apply(newMoveCommand(t), nil); err == nil {
+		t.Fatal("expected an error for a non numeric batch size")
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	config := &Config{Environments: map[string]*Environment{"prod": {}, "dev": {}}}
+
+	if _, err := config.Environment("prod"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := config.Environment("nope")
+	if err == nil || err.Error() != "Unknown environment 'nope', available environments: [dev, prod]" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
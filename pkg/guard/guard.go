@@ -0,0 +1,131 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package guard implements the safety rails shared by every command that changes
+// something: --dry-run, the confirmation prompt and the protected environments.
+package guard
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/raffs/sysadmin-sk/pkg/config"
+)
+
+// ErrAborted is returned when the user does not confirm the operation
+var ErrAborted = errors.New("Operation aborted, nothing was changed")
+
+// Options defines the flags of the commands that change something
+type Options struct {
+
+	// Only show what would be changed, without changing anything
+	DryRun bool `type:"bool" required:"false"`
+
+	// Do not ask for confirmation, for automation
+	Yes bool `type:"bool" required:"false"`
+}
+
+// Plan describes what a command is about to change
+type Plan struct {
+
+	// Short description of the operation (e.g: "Move messages between SQS queues")
+	Action string
+
+	// Where the changes happen, the AWS account ID or kubernetes context. That's
+	// what the user needs to type to confirm changes on protected environments.
+	Target string
+
+	// One line for each change
+	Changes []string
+}
+
+// AddFlags registers the --dry-run and --yes flags on the given flag set
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(&o.DryRun, "dry-run", "", false, "Only show what would be changed, without changing anything")
+	flags.BoolVarP(&o.Yes, "yes", "y", false, "Do not ask for confirmation (e.g: for automation)")
+}
+
+// Confirm prints the plan and asks the user to confirm it. It returns false, and
+// no error, on dry-run, in which case the command must stop without changing
+// anything. On protected environments the user needs to type the plan target.
+func Confirm(options *Options, plan *Plan) (bool, error) {
+	env := config.Current()
+	printPlan(plan, env)
+
+	if options.DryRun {
+		fmt.Fprintln(os.Stderr, "Dry-run: nothing was changed")
+		return false, nil
+	}
+
+	if options.Yes {
+		return true, nil
+	}
+
+	if !isTerminal() {
+		return false, errors.New("Refusing to change anything without confirmation, use --yes when not running on a terminal")
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	if env != nil && env.Protected {
+		fmt.Fprintf(os.Stderr, "Environment '%s' is protected, type '%s' to continue: ", env.Name, plan.Target)
+		answer, _ := reader.ReadString('\n')
+		if strings.TrimSpace(answer) != plan.Target || plan.Target == "" {
+			return false, ErrAborted
+		}
+		return true, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Do you want to continue? [y/N]: ")
+	answer, _ := reader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+
+	return false, ErrAborted
+}
+
+func printPlan(plan *Plan, env *config.Environment) {
+	fmt.Fprintf(os.Stderr, "\n+ %s\n", plan.Action)
+	if env != nil {
+		fmt.Fprintf(os.Stderr, "Environment: %s\n", env.Name)
+	}
+	if plan.Target != "" {
+		fmt.Fprintf(os.Stderr, "Target: %s\n", plan.Target)
+	}
+
+	for _, change := range plan.Changes {
+		fmt.Fprintf(os.Stderr, "  - %s\n", change)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// isTerminal returns whether the confirmation can be asked interactively
+func isTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,115 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"sigs.k8s.io/yaml"
+)
+
+// encodePrinter buffers all the objects and prints them as a single list
+type encodePrinter struct {
+	w       io.Writer
+	items   []interface{}
+	marshal func(obj interface{}) ([]byte, error)
+}
+
+func newJSONPrinter(w io.Writer) *encodePrinter {
+	return &encodePrinter{w: w, items: []interface{}{}, marshal: func(obj interface{}) ([]byte, error) {
+		var buffer bytes.Buffer
+
+		encoder := json.NewEncoder(&buffer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+
+		err := encoder.Encode(obj)
+		return buffer.Bytes(), err
+	}}
+}
+
+func newYAMLPrinter(w io.Writer) *encodePrinter {
+	return &encodePrinter{w: w, items: []interface{}{}, marshal: yaml.Marshal}
+}
+
+func (p *encodePrinter) Print(obj interface{}) error {
+	item, err := Prune(obj)
+	if err != nil {
+		return err
+	}
+
+	p.items = append(p.items, item)
+	return nil
+}
+
+func (p *encodePrinter) Flush() error {
+	content, err := p.marshal(p.items)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.w.Write(content)
+	return err
+}
+
+// Prune returns the generic (JSON) representation of the object without the
+// null and empty fields. The AWS SDK types do not omit empty fields, which makes
+// the json and yaml outputs hard to read otherwise.
+func Prune(obj interface{}) (interface{}, error) {
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(content, &generic); err != nil {
+		return nil, err
+	}
+
+	return prune(generic), nil
+}
+
+func prune(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item = prune(item); item == nil {
+				delete(v, key)
+			} else {
+				v[key] = item
+			}
+		}
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		items := v[:0]
+		for _, item := range v {
+			if item = prune(item); item != nil {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return items
+	}
+
+	return value
+}
@@ -0,0 +1,55 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package output
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Age returns how long ago the given time was, in a short human format (e.g: 5d, 3h)
+func Age(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "<unknown>"
+	}
+
+	d := time.Since(*t)
+	switch {
+	case d < 0:
+		return "0s"
+	case d < 2*time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < 2*time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 2*365*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+
+	return fmt.Sprintf("%dy", int(d.Hours()/24/365))
+}
+
+// Join returns the values joined by comma, or <none> when empty
+func Join(values []string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,134 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package output prints the result of the list commands on the format chosen by
+// the user with the -o/--output flag: table, wide, json, yaml, csv, go-template
+// or jsonpath.
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// the supported output formats
+const (
+	FormatTable          = "table"
+	FormatWide           = "wide"
+	FormatJSON           = "json"
+	FormatYAML           = "yaml"
+	FormatCSV            = "csv"
+	FormatGoTemplate     = "go-template"
+	FormatGoTemplateFile = "go-template-file"
+	FormatJSONPath       = "jsonpath"
+)
+
+// Options defines how the command results are printed
+type Options struct {
+
+	// The output format, templates are given as format=template (e.g: jsonpath={.Name})
+	Format string `type:"string" required:"false"`
+
+	// Go template given on the deprecated --format flag
+	legacyTemplate string
+}
+
+// Column describes one column of the table, wide and csv outputs
+type Column struct {
+
+	// Column header, printed in upper case
+	Header string
+
+	// Whether the column is only shown on the wide and csv outputs
+	Wide bool
+
+	// Returns the value of this column for the given object
+	Value func(obj interface{}) string
+}
+
+// Printer prints objects on the chosen output format. Some formats need all the
+// objects before printing anything (e.g: json), so Flush must always be called.
+type Printer interface {
+
+	// Print adds an object to the output
+	Print(obj interface{}) error
+
+	// Flush writes any buffered output
+	Flush() error
+}
+
+// AddFlags registers the --output flag on the given flag set
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.Format, "output", "o", FormatTable,
+		"Output format: table|wide|json|yaml|csv|go-template=...|go-template-file=...|jsonpath=...")
+}
+
+// AddLegacyFormatFlag registers the deprecated --format flag, which took a go
+// template, for the commands which used to have it.
+func (o *Options) AddLegacyFormatFlag(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.legacyTemplate, "format", "", "", "Display the format")
+	flags.MarkDeprecated("format", "use --output go-template=... instead")
+}
+
+// NewPrinter returns the printer for the chosen output format
+func NewPrinter(w io.Writer, options *Options, columns []Column) (Printer, error) {
+	if options.legacyTemplate != "" {
+		return newTemplatePrinter(w, options.legacyTemplate, true)
+	}
+
+	format, arg := options.Format, ""
+	if i := strings.Index(format, "="); i >= 0 {
+		format, arg = format[:i], format[i+1:]
+	}
+
+	switch format {
+	case FormatTable, "":
+		return newTablePrinter(w, columns, false), nil
+	case FormatWide:
+		return newTablePrinter(w, columns, true), nil
+	case FormatCSV:
+		return newCSVPrinter(w, columns), nil
+	case FormatJSON:
+		return newJSONPrinter(w), nil
+	case FormatYAML:
+		return newYAMLPrinter(w), nil
+	case FormatGoTemplate:
+		return newTemplatePrinter(w, arg, false)
+	case FormatGoTemplateFile:
+		content, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read the template file: %v", err)
+		}
+		return newTemplatePrinter(w, string(content), false)
+	case FormatJSONPath:
+		return newJSONPathPrinter(w, arg)
+	}
+
+	return nil, errors.New("Invalid output format '" + options.Format + "', use one of: " +
+		"table, wide, json, yaml, csv, go-template=..., go-template-file=..., jsonpath=...")
+}
+
+// Validate checks the output options, so commands can fail before calling any API
+func (o *Options) Validate() error {
+	_, err := NewPrinter(ioutil.Discard, o, nil)
+	return err
+}
@@ -0,0 +1,196 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package output
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testItem struct {
+	Name    string
+	Count   int
+	Tags    []string
+	Nothing *string
+	Tasks   []*testItem
+}
+
+func (i *testItem) Children() ([]Column, []interface{}) {
+	var children []interface{}
+	for _, child := range i.Tasks {
+		children = append(children, child)
+	}
+	return testColumns[:1], children
+}
+
+var testColumns = []Column{
+	{Header: "Name", Value: func(obj interface{}) string { return obj.(*testItem).Name }},
+	{Header: "Tags", Wide: true, Value: func(obj interface{}) string { return Join(obj.(*testItem).Tags) }},
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  interface{}
+		want interface{}
+	}{
+		{
+			name: "null and empty fields are removed",
+			obj:  &testItem{Name: "web", Tags: []string{}},
+			want: map[string]interface{}{"Name": "web", "Count": float64(0)},
+		},
+		{
+			name: "nested empty objects are removed",
+			obj: map[string]interface{}{
+				"a": map[string]interface{}{"b": nil, "c": []interface{}{}},
+				"d": []interface{}{nil, "x", map[string]interface{}{}},
+			},
+			want: map[string]interface{}{"d": []interface{}{"x"}},
+		},
+		{
+			name: "an empty object is nil",
+			obj:  map[string]interface{}{"a": nil},
+			want: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Prune(test.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Prune() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPrinters(t *testing.T) {
+	items := []*testItem{
+		{Name: "web", Tags: []string{"a", "b"}, Tasks: []*testItem{{Name: "task-1"}}},
+		{Name: "worker-long-name", Count: 2},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: FormatTable,
+			want: "NAME\n" +
+				"web\n" +
+				"    NAME\n" +
+				"    task-1\n" +
+				"worker-long-name\n",
+		},
+		{
+			format: FormatWide,
+			want: "NAME               TAGS\n" +
+				"web                a,b\n" +
+				"    NAME\n" +
+				"    task-1\n" +
+				"worker-long-name   <none>\n",
+		},
+		{
+			format: FormatCSV,
+			want:   "NAME,TAGS\nweb,\"a,b\"\nworker-long-name,<none>\n",
+		},
+		{
+			format: FormatJSON,
+			want: "[\n" +
+				"  {\n" +
+				"    \"Count\": 0,\n    \"Name\": \"web\",\n    \"Tags\": [\n      \"a\",\n      \"b\"\n    ],\n    \"Tasks\": [\n      {\n        \"Count\": 0,\n        \"Name\": \"task-1\"\n      }\n    ]\n  },\n" +
+				"  {\n    \"Count\": 2,\n    \"Name\": \"worker-long-name\"\n  }\n" +
+				"]\n",
+		},
+		{
+			format: FormatYAML,
+			want: "- Count: 0\n  Name: web\n  Tags:\n  - a\n  - b\n  Tasks:\n  - Count: 0\n    Name: task-1\n" +
+				"- Count: 2\n  Name: worker-long-name\n",
+		},
+		{
+			format: "go-template={{.Name}}\t{{.Count}}",
+			want:   "web                0\nworker-long-name   2\n",
+		},
+		{
+			format: "jsonpath={.Name}",
+			want:   "web\nworker-long-name\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buffer bytes.Buffer
+			printer, err := NewPrinter(&buffer, &Options{Format: test.format}, testColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, item := range items {
+				if err := printer.Print(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := printer.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buffer.String(); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEmptyOutputs(t *testing.T) {
+	tests := map[string]string{
+		FormatTable: "",
+		FormatCSV:   "NAME,TAGS\n",
+		FormatJSON:  "[]\n",
+	}
+
+	for format, want := range tests {
+		var buffer bytes.Buffer
+		printer, err := NewPrinter(&buffer, &Options{Format: format}, testColumns)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := printer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := buffer.String(); got != want {
+			t.Errorf("%s: got %q, want %q", format, got, want)
+		}
+	}
+}
+
+func TestInvalidFormat(t *testing.T) {
+	if _, err := NewPrinter(&bytes.Buffer{}, &Options{Format: "xml"}, testColumns); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+
+	if err := (&Options{Format: "go-template={{.Name"}).Validate(); err == nil {
+		t.Fatal("expected an error for an invalid template")
+	}
+}
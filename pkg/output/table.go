@@ -0,0 +1,207 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// the space between the table columns and the indentation of the nested tables
+const (
+	columnPadding = "   "
+	nestedIndent  = "    "
+)
+
+// Nested is implemented by the objects which carry child objects (e.g: the tasks
+// of a service). On the table outputs, the children are printed as a table of
+// their own, indented under the object row.
+type Nested interface {
+	Children() (columns []Column, children []interface{})
+}
+
+// tablePrinter prints the objects as aligned columns, with a header line. The
+// rows are buffered until Flush, so the columns can be aligned.
+type tablePrinter struct {
+	w       io.Writer
+	columns []Column
+	wide    bool
+	rows    []*tableRow
+}
+
+// tableRow is one object of the table, along with its nested table if any
+type tableRow struct {
+	cells  []string
+	nested [][]string
+}
+
+func newTablePrinter(w io.Writer, columns []Column, wide bool) *tablePrinter {
+	return &tablePrinter{w: w, columns: visibleColumns(columns, wide), wide: wide}
+}
+
+func (p *tablePrinter) Print(obj interface{}) error {
+	row := &tableRow{cells: values(p.columns, obj)}
+
+	if nested, ok := obj.(Nested); ok {
+		columns, children := nested.Children()
+		if len(children) > 0 {
+			columns = visibleColumns(columns, p.wide)
+
+			row.nested = append(row.nested, headers(columns))
+			for _, child := range children {
+				row.nested = append(row.nested, values(columns, child))
+			}
+		}
+	}
+
+	p.rows = append(p.rows, row)
+	return nil
+}
+
+func (p *tablePrinter) Flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+
+	table := [][]string{headers(p.columns)}
+	for _, row := range p.rows {
+		table = append(table, row.cells)
+	}
+	widths := columnWidths(table)
+
+	if err := writeRow(p.w, "", widths, table[0]); err != nil {
+		return err
+	}
+
+	for _, row := range p.rows {
+		if err := writeRow(p.w, "", widths, row.cells); err != nil {
+			return err
+		}
+
+		nestedWidths := columnWidths(row.nested)
+		for _, cells := range row.nested {
+			if err := writeRow(p.w, nestedIndent, nestedWidths, cells); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.rows = nil
+	return nil
+}
+
+func visibleColumns(columns []Column, wide bool) []Column {
+	var visible []Column
+	for _, column := range columns {
+		if wide || !column.Wide {
+			visible = append(visible, column)
+		}
+	}
+
+	return visible
+}
+
+func columnWidths(table [][]string) []int {
+	var widths []int
+	for _, cells := range table {
+		for i, cell := range cells {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	return widths
+}
+
+func writeRow(w io.Writer, indent string, widths []int, cells []string) error {
+	var line strings.Builder
+	line.WriteString(indent)
+
+	for i, cell := range cells {
+		line.WriteString(cell)
+		if i < len(cells)-1 {
+			line.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			line.WriteString(columnPadding)
+		}
+	}
+
+	line.WriteString("\n")
+	_, err := io.WriteString(w, line.String())
+	return err
+}
+
+// csvPrinter prints all the columns, including the wide ones, as CSV
+type csvPrinter struct {
+	w       *csv.Writer
+	columns []Column
+	header  bool
+}
+
+func newCSVPrinter(w io.Writer, columns []Column) *csvPrinter {
+	return &csvPrinter{w: csv.NewWriter(w), columns: columns}
+}
+
+func (p *csvPrinter) Print(obj interface{}) error {
+	if err := p.printHeader(); err != nil {
+		return err
+	}
+
+	return p.w.Write(values(p.columns, obj))
+}
+
+func (p *csvPrinter) printHeader() error {
+	if p.header {
+		return nil
+	}
+
+	p.header = true
+	return p.w.Write(headers(p.columns))
+}
+
+func (p *csvPrinter) Flush() error {
+	// always print the header, so consumers can tell there are no results
+	if err := p.printHeader(); err != nil {
+		return err
+	}
+
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func headers(columns []Column) []string {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = strings.ToUpper(column.Header)
+	}
+
+	return row
+}
+
+func values(columns []Column, obj interface{}) []string {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = column.Value(obj)
+	}
+
+	return row
+}
@@ -0,0 +1,113 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"text/template"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// templatePrinter executes a go template for each object, one line per object.
+// Unlike the previous html/template based output, nothing gets escaped and tabs
+// are aligned as columns.
+type templatePrinter struct {
+	tabw     *tabwriter.Writer
+	template *template.Template
+
+	// the deprecated --format templates handle the new lines themselves
+	legacy bool
+}
+
+func newTemplatePrinter(w io.Writer, text string, legacy bool) (*templatePrinter, error) {
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Not able to parse template '%s': %v", text, err)
+	}
+
+	tabw := new(tabwriter.Writer)
+	tabw.Init(w, 0, 8, 3, ' ', 0)
+
+	return &templatePrinter{tabw: tabw, template: tmpl, legacy: legacy}, nil
+}
+
+func (p *templatePrinter) Print(obj interface{}) error {
+	if err := p.template.Execute(p.tabw, obj); err != nil {
+		return err
+	}
+
+	if !p.legacy {
+		_, err := io.WriteString(p.tabw, "\n")
+		return err
+	}
+
+	return nil
+}
+
+func (p *templatePrinter) Flush() error {
+	if p.legacy {
+		io.WriteString(p.tabw, "\n")
+	}
+
+	return p.tabw.Flush()
+}
+
+// jsonPathPrinter evaluates a jsonpath expression on the JSON representation of
+// each object, printing one line per object.
+type jsonPathPrinter struct {
+	w    io.Writer
+	path *jsonpath.JSONPath
+}
+
+func newJSONPathPrinter(w io.Writer, expression string) (*jsonPathPrinter, error) {
+	path := jsonpath.New("output").AllowMissingKeys(true)
+	if err := path.Parse(expression); err != nil {
+		return nil, fmt.Errorf("Not able to parse jsonpath '%s': %v", expression, err)
+	}
+
+	return &jsonPathPrinter{w: w, path: path}, nil
+}
+
+func (p *jsonPathPrinter) Print(obj interface{}) error {
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(content, &generic); err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	if err := p.path.Execute(&buffer, generic); err != nil {
+		return err
+	}
+
+	buffer.WriteString("\n")
+	_, err = p.w.Write(buffer.Bytes())
+	return err
+}
+
+func (p *jsonPathPrinter) Flush() error {
+	return nil
+}
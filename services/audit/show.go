@@ -0,0 +1,172 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// showOptions defines the options used on the `audit show` command
+type showOptions struct {
+
+	// only show the records newer than this
+	since time.Duration `type:"duration" required:"false"`
+
+	// only show the records of this command (e.g: "aws-sqs move")
+	command string `type:"string" required:"false"`
+
+	// how to print the records
+	output output.Options `type:"output.Options" required:"false"`
+}
+
+// recordColumns defines the table columns of the `audit show` command
+var recordColumns = []output.Column{
+	{Header: "Time", Value: func(obj interface{}) string {
+		return obj.(*audit.Record).Time.Local().Format("2006-01-02 15:04:05")
+	}},
+	{Header: "User", Value: func(obj interface{}) string {
+		return obj.(*audit.Record).User
+	}},
+	{Header: "Command", Value: func(obj interface{}) string {
+		return obj.(*audit.Record).Command
+	}},
+	{Header: "Target", Value: func(obj interface{}) string {
+		return target(obj.(*audit.Record))
+	}},
+	{Header: "Result", Value: func(obj interface{}) string {
+		return obj.(*audit.Record).Result
+	}},
+	{Header: "Counts", Value: func(obj interface{}) string {
+		return counts(obj.(*audit.Record).Counts)
+	}},
+	{Header: "Environment", Wide: true, Value: func(obj interface{}) string {
+		return obj.(*audit.Record).Environment
+	}},
+	{Header: "Host", Wide: true, Value: func(obj interface{}) string {
+		return obj.(*audit.Record).Host
+	}},
+	{Header: "Args", Wide: true, Value: func(obj interface{}) string {
+		return strings.Join(obj.(*audit.Record).Args, " ")
+	}},
+	{Header: "Error", Wide: true, Value: func(obj interface{}) string {
+		return obj.(*audit.Record).Error
+	}},
+}
+
+// target returns the non-empty target fields, e.g: "123456789012/us-east-1"
+func target(record *audit.Record) string {
+	var parts []string
+	for _, part := range []string{
+		record.Target.Account,
+		record.Target.Region,
+		record.Target.Cluster,
+		record.Target.Context,
+		record.Target.Namespace,
+	} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "<none>"
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func counts(values map[string]int64) string {
+	var pairs []string
+	for name, value := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", name, value))
+	}
+	sort.Strings(pairs)
+
+	return output.Join(pairs)
+}
+
+// showRecords prints the audit records matching the options
+func showRecords(options *showOptions) error {
+	printer, err := output.NewPrinter(os.Stdout, &options.output, recordColumns)
+	if err != nil {
+		return err
+	}
+
+	since := time.Time{}
+	if options.since > 0 {
+		since = time.Now().Add(-options.since)
+	}
+
+	records, err := audit.Read(since)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if options.command != "" && record.Command != options.command {
+			continue
+		}
+
+		if err := printer.Print(record); err != nil {
+			return err
+		}
+	}
+
+	return printer.Flush()
+}
+
+func validateArgs(options *showOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Invalid number of arguments for audit show command. Use --help for details")
+	}
+
+	return options.output.Validate()
+}
+
+// ShowCommand Return the `audit show` command in cobra format, which prints the
+// operations recorded on the local audit log.
+func ShowCommand() *cobra.Command {
+	var options showOptions
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the operations recorded on the local audit log",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := validateArgs(&options, args)
+			if err != nil {
+				return err
+			}
+
+			return showRecords(&options)
+		},
+	}
+
+	cmd.PersistentFlags().DurationVarP(&options.since, "since", "s", 0, "Only show the operations newer than this (e.g: 24h)")
+	cmd.PersistentFlags().StringVarP(&options.command, "command", "c", "", "Only show the operations of this command (e.g: \"aws-sqs move\")")
+	options.output.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
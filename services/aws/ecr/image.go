@@ -0,0 +1,147 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+)
+
+// registryPattern matches the ECR registries, e.g: 123456789012.dkr.ecr.us-east-1.amazonaws.com
+var registryPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ImageReference is an image stored on ECR
+type ImageReference struct {
+	RegistryID string
+	Region     string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ImageStatus is what ECR knows about an image
+type ImageStatus struct {
+
+	// Whether the image (or its repository) still exists
+	Exists bool
+
+	// The digest the tag currently points to
+	Digest string `json:",omitempty"`
+
+	// When the image was pushed
+	PushedAt *time.Time `json:",omitempty"`
+
+	// The status of the last scan, and the number of findings per severity
+	ScanStatus string           `json:",omitempty"`
+	Findings   map[string]int64 `json:",omitempty"`
+}
+
+// ParseImage returns the ECR reference of the image, false when the image is
+// not stored on ECR.
+func ParseImage(image string) (*ImageReference, bool) {
+	slash := strings.Index(image, "/")
+	if slash < 0 {
+		return nil, false
+	}
+
+	match := registryPattern.FindStringSubmatch(image[:slash])
+	if match == nil {
+		return nil, false
+	}
+
+	reference := &ImageReference{RegistryID: match[1], Region: match[3]}
+	repository := image[slash+1:]
+
+	if at := strings.Index(repository, "@"); at >= 0 {
+		repository, reference.Digest = repository[:at], repository[at+1:]
+	}
+
+	if colon := strings.LastIndex(repository, ":"); colon >= 0 {
+		repository, reference.Tag = repository[:colon], repository[colon+1:]
+	}
+
+	if reference.Tag == "" && reference.Digest == "" {
+		reference.Tag = "latest"
+	}
+
+	reference.Repository = repository
+	return reference, true
+}
+
+// DescribeImage returns what ECR knows about the image, looked up by digest when
+// the reference has one, by tag otherwise. Images deleted (e.g: by a lifecycle
+// policy) are returned as not existing, rather than as an error.
+func DescribeImage(options *awssession.Options, reference *ImageReference) (*ImageStatus, error) {
+	session, err := awssession.New(options.InRegion(reference.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	imageID := &ecr.ImageIdentifier{}
+	if reference.Digest != "" {
+		imageID.ImageDigest = aws.String(reference.Digest)
+	} else {
+		imageID.ImageTag = aws.String(reference.Tag)
+	}
+
+	description, err := ecr.New(session).DescribeImages(&ecr.DescribeImagesInput{
+		RegistryId:     aws.String(reference.RegistryID),
+		RepositoryName: aws.String(reference.Repository),
+		ImageIds:       []*ecr.ImageIdentifier{imageID},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case ecr.ErrCodeImageNotFoundException, ecr.ErrCodeRepositoryNotFoundException:
+				return &ImageStatus{}, nil
+			}
+		}
+		return nil, fmt.Errorf("Unable to describe image %s: %v", reference.Repository, err)
+	}
+
+	if len(description.ImageDetails) == 0 {
+		return &ImageStatus{}, nil
+	}
+
+	detail := description.ImageDetails[0]
+	status := &ImageStatus{
+		Exists:   true,
+		Digest:   aws.StringValue(detail.ImageDigest),
+		PushedAt: detail.ImagePushedAt,
+	}
+
+	if detail.ImageScanStatus != nil {
+		status.ScanStatus = aws.StringValue(detail.ImageScanStatus.Status)
+	}
+
+	if summary := detail.ImageScanFindingsSummary; summary != nil && len(summary.FindingSeverityCounts) > 0 {
+		status.Findings = make(map[string]int64)
+		for severity, count := range summary.FindingSeverityCounts {
+			status.Findings[severity] = aws.Int64Value(count)
+		}
+	}
+
+	return status, nil
+}
@@ -3,15 +3,14 @@ package ecr
 import (
 	"errors"
 	"fmt"
-	"html/template"
 	"os"
-	"strings"
-	"text/tabwriter"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ecr"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
 )
 
 // ListOptions defines the options used on the `aws ecs list` command
@@ -23,87 +22,79 @@ type listOptions struct {
 
 	tagStatus string `type:"string" required:"true"`
 
-	// the format to output the string
-	format string `type:"string" required:"false"`
-
-	// Define which AWS region to connect to the service
-	awsRegion string `type:"string" required:"false"`
+	// how to print the images
+	output output.Options `type:"output.Options" required:"false"`
 
-	// Define the AWS API endpoint. Usually this is use for lower-level API call
-	// and for testing and/or mocking.
-	awsEndpoint string `type:"string" required:"false"`
-
-	// Define the AWS profile
-	awsProfile string `type:"string" required:"false"`
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
 }
 
 // ecsClient Return a AWS ECS client with an open session.
 func ecrClient(options *listOptions) (*ecr.ECR, error) {
-	sessionOpts := session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-		// aws configuration
-		Config: aws.Config{
-			Region:   aws.String(options.awsRegion),
-			Endpoint: aws.String(options.awsEndpoint),
-		},
-	}
-
-	session, err := session.NewSessionWithOptions(sessionOpts)
+	session, err := awssession.New(&options.awsOptions)
 	if err != nil {
-		fmt.Println("Unable to create new session with AWS with error: ", err.Error())
-		return nil, errors.New("Unable to initialize AWS session")
+		return nil, err
 	}
 
 	return ecr.New(session), nil
 }
 
-// listServices
-func listImages(options *listOptions) error {
-	tabw := new(tabwriter.Writer)
-	tabw.Init(os.Stdout, 20, 1, 3, ' ', 0)
-	defer tabw.Flush()
+// imageColumns defines the table columns of the `aws-ecr listImages` command
+var imageColumns = []output.Column{
+	{Header: "Tags", Value: func(obj interface{}) string {
+		return output.Join(aws.StringValueSlice(obj.(*ecr.ImageDetail).ImageTags))
+	}},
+	{Header: "Digest", Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*ecr.ImageDetail).ImageDigest)
+	}},
+	{Header: "Size", Value: func(obj interface{}) string {
+		return fmt.Sprintf("%.1fMB", float64(aws.Int64Value(obj.(*ecr.ImageDetail).ImageSizeInBytes))/1024/1024)
+	}},
+	{Header: "Pushed", Value: func(obj interface{}) string {
+		return output.Age(obj.(*ecr.ImageDetail).ImagePushedAt)
+	}},
+	{Header: "Repository", Wide: true, Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*ecr.ImageDetail).RepositoryName)
+	}},
+	{Header: "Registry", Wide: true, Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*ecr.ImageDetail).RegistryId)
+	}},
+	{Header: "Scan Status", Wide: true, Value: func(obj interface{}) string {
+		if status := obj.(*ecr.ImageDetail).ImageScanStatus; status != nil {
+			return aws.StringValue(status.Status)
+		}
+		return "<none>"
+	}},
+}
 
-	template, err := template.New("").Parse(options.format)
+// listImages
+func listImages(options *listOptions) error {
+	printer, err := output.NewPrinter(os.Stdout, &options.output, imageColumns)
 	if err != nil {
-		fmt.Println("Not able to parse template: ", options.format)
-		return errors.New("Failed to parse the above template")
+		return err
 	}
 
-	columns := strings.Replace(options.format, "{{", "", -1)
-	columns = strings.Replace(columns, "}}", "", -1)
-	columns = strings.Replace(columns, ".", "", -1)
-	columns = strings.Replace(columns, "\n", "", -1)
-	fmt.Fprintf(tabw, "%v", columns)
-
 	client, err := ecrClient(options)
 	if err != nil {
 		return err
 	}
 
-
-	listImagesFilter := &ecr.ListImagesFilter{TagStatus: &options.tagStatus}
-
-
 	listImagesInput := &ecr.ListImagesInput{
-		Filter:    listImagesFilter,
-		MaxResults: aws.Int64(100),
+		MaxResults:     aws.Int64(100),
 		RepositoryName: aws.String(options.repositoryName),
 	}
 
-	if options.repositoryName != "" && options.registryId != "" {
-		listImagesInput = &ecr.ListImagesInput{
-			Filter:    listImagesFilter,
-			MaxResults: aws.Int64(100),
-			RepositoryName: aws.String(options.repositoryName),
-			RegistryId: aws.String(options.registryId),
-		}
+	if options.tagStatus != "" {
+		listImagesInput.Filter = &ecr.ListImagesFilter{TagStatus: aws.String(options.tagStatus)}
 	}
 
-
-
+	if options.registryId != "" {
+		listImagesInput.RegistryId = aws.String(options.registryId)
+	}
 
 	// loop until there's no more page
-	for imageList, err := client.ListImages(listImagesInput); ; {
+	for {
+		imageList, err := client.ListImages(listImagesInput)
 		if err != nil {
 			return err
 		}
@@ -116,7 +107,9 @@ func listImages(options *listOptions) error {
 			}
 
 			describeInput := &ecr.DescribeImagesInput{
-				ImageIds: imageList.ImageIds[i:upperBound],
+				ImageIds:       imageList.ImageIds[i:upperBound],
+				RepositoryName: listImagesInput.RepositoryName,
+				RegistryId:     listImagesInput.RegistryId,
 			}
 
 			imageDescription, err := client.DescribeImages(describeInput)
@@ -125,8 +118,9 @@ func listImages(options *listOptions) error {
 			}
 
 			for _, image := range imageDescription.ImageDetails {
-				template.Execute(tabw, image)
-				tabw.Flush()
+				if err := printer.Print(image); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -134,15 +128,10 @@ func listImages(options *listOptions) error {
 			break
 		}
 
-		imageList.NextToken = imageList.NextToken
-	}
-
-	if err != nil {
-		return err
+		listImagesInput.NextToken = imageList.NextToken
 	}
 
-	fmt.Println("")
-	return nil
+	return printer.Flush()
 }
 
 func validateArgs(options *listOptions, args []string) error {
@@ -150,6 +139,10 @@ func validateArgs(options *listOptions, args []string) error {
 		return errors.New("Invalid number of arguments for aws-ecr list images command. Use --help for details")
 	}
 
+	if err := options.output.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -172,14 +165,10 @@ func ListImagesCommand() *cobra.Command {
 		},
 	}
 
-	// default output template
-	defaultTempl := "\n{{.ImageId}}\t{{.Status}}\t{{.RunningCount}}/{{.DesiredCount}}\t{{.ServiceName}}"
-
-	cmd.PersistentFlags().StringVarP(&options.awsRegion, "aws-region", "r", "", "define AWS region.")
-	cmd.PersistentFlags().StringVarP(&options.awsProfile, "aws-profile", "p", "", "define AWS profile")
-	cmd.PersistentFlags().StringVarP(&options.awsEndpoint, "aws-endpoint", "e", "", "Define the AWS API endpoint (usually for low-level and testing")
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
 	cmd.PersistentFlags().StringVarP(&options.repositoryName, "repository-name", "f", "", "Name of the ECR repository to scan")
-	cmd.PersistentFlags().StringVarP(&options.format, "format", "", defaultTempl, "Display the format")
+	options.output.AddFlags(cmd.PersistentFlags())
+	options.output.AddLegacyFormatFlag(cmd.PersistentFlags())
 	cmd.PersistentFlags().StringVarP(&options.registryId, "registry-id", "", "", "The AWS ECR registry to use")
 	cmd.PersistentFlags().StringVarP(&options.tagStatus, "tag-status", "", "", "The tag status with which to filter your ListImages results. You can filter results on the following vars TAGGED/UNTAGGED/ANY")
 	return cmd
@@ -0,0 +1,576 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// capacityOptions defines the options used on the `aws-ecs capacity` command
+type capacityOptions struct {
+
+	// cluster to report the capacity of
+	clusterName string `type:"string" required:"true"`
+
+	// how to print the report
+	output output.Options `type:"output.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// resources are CPU units and memory in MiB, as ECS accounts them
+type resources struct {
+	CPU    int64
+	Memory int64
+}
+
+// instanceCapacity is the capacity of one container instance
+type instanceCapacity struct {
+	ContainerInstance string
+	Ec2InstanceId     string
+	InstanceType      string `json:",omitempty"`
+	AvailabilityZone  string `json:",omitempty"`
+	Status            string
+	AgentVersion      string
+	AgentConnected    bool
+	RunningTasks      int64
+	PendingTasks      int64
+	Registered        resources
+	Remaining         resources
+
+	// Running tasks, counted by task definition (family:revision)
+	TaskDefinitions map[string]int `json:",omitempty"`
+
+	// The running tasks which were not started by a service, counted by task
+	// definition. They are part of TaskDefinitions too.
+	StandaloneTasks map[string]int `json:",omitempty"`
+
+	// Whether every task definition in use can be placed on the instance
+	FitsTasksInUse bool
+}
+
+// taskRequirement is what a task definition needs to be placed
+type taskRequirement struct {
+	TaskDefinition string
+	resources
+}
+
+// capacityReport is the capacity of the whole cluster
+type capacityReport struct {
+	Cluster    string
+	Instances  []*instanceCapacity
+	Registered resources
+	Remaining  resources
+
+	// The task definitions used by the services placed on the instances
+	TasksInUse []*taskRequirement `json:",omitempty"`
+
+	// How many active instances can place every task definition in use
+	InstancesFitting int
+
+	// The task definitions in use which fit on no active instance
+	Unplaceable []*taskRequirement `json:",omitempty"`
+
+	// Percentage of the free CPU and memory on instances which can't place any
+	// task definition in use, that is capacity that looks free but can't be used.
+	Fragmentation struct {
+		CPU    float64
+		Memory float64
+	}
+}
+
+// capacityColumns defines the table columns of the `aws-ecs capacity` command
+var capacityColumns = []output.Column{
+	{Header: "Instance", Value: func(obj interface{}) string {
+		return obj.(*instanceCapacity).Ec2InstanceId
+	}},
+	{Header: "Type", Wide: true, Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*instanceCapacity).InstanceType)
+	}},
+	{Header: "AZ", Wide: true, Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*instanceCapacity).AvailabilityZone)
+	}},
+	{Header: "Status", Value: func(obj interface{}) string {
+		return obj.(*instanceCapacity).Status
+	}},
+	{Header: "Agent", Value: func(obj interface{}) string {
+		instance := obj.(*instanceCapacity)
+		if !instance.AgentConnected {
+			return instance.AgentVersion + " (disconnected)"
+		}
+		return instance.AgentVersion
+	}},
+	{Header: "Tasks", Value: func(obj interface{}) string {
+		instance := obj.(*instanceCapacity)
+		if instance.PendingTasks > 0 {
+			return fmt.Sprintf("%d (+%d pending)", instance.RunningTasks, instance.PendingTasks)
+		}
+		return fmt.Sprint(instance.RunningTasks)
+	}},
+	{Header: "CPU", Value: func(obj interface{}) string {
+		instance := obj.(*instanceCapacity)
+		return usage(instance.Registered.CPU-instance.Remaining.CPU, instance.Registered.CPU)
+	}},
+	{Header: "Memory", Value: func(obj interface{}) string {
+		instance := obj.(*instanceCapacity)
+		return usage(instance.Registered.Memory-instance.Remaining.Memory, instance.Registered.Memory)
+	}},
+	{Header: "Free CPU", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*instanceCapacity).Remaining.CPU)
+	}},
+	{Header: "Free Memory", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*instanceCapacity).Remaining.Memory)
+	}},
+	{Header: "Fits All", Value: func(obj interface{}) string {
+		if obj.(*instanceCapacity).FitsTasksInUse {
+			return "yes"
+		}
+		return "no"
+	}},
+	{Header: "Task Definitions", Wide: true, Value: func(obj interface{}) string {
+		return taskDefinitionCounts(obj.(*instanceCapacity).TaskDefinitions)
+	}},
+}
+
+// reportCapacity prints the capacity of every container instance of the cluster,
+// followed by the cluster totals.
+func reportCapacity(options *capacityOptions) error {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	report := &capacityReport{Cluster: options.clusterName}
+
+	report.Instances, err = describeInstancesCapacity(client, options.clusterName)
+	if err != nil {
+		return err
+	}
+
+	report.TasksInUse, err = tasksInUse(client, options)
+	if err != nil {
+		return err
+	}
+
+	report.summarize()
+
+	// the structured formats get the whole report, the tables one row per instance
+	switch options.output.Format {
+	case output.FormatTable, output.FormatWide, output.FormatCSV, "":
+	default:
+		printer, err := output.NewPrinter(os.Stdout, &options.output, nil)
+		if err != nil {
+			return err
+		}
+
+		if err := printer.Print(report); err != nil {
+			return err
+		}
+
+		return printer.Flush()
+	}
+
+	printer, err := output.NewPrinter(os.Stdout, &options.output, capacityColumns)
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range report.Instances {
+		if err := printer.Print(instance); err != nil {
+			return err
+		}
+	}
+
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+
+	if options.output.Format != output.FormatCSV {
+		report.printSummary()
+	}
+
+	return nil
+}
+
+// summarize computes the cluster totals out of the instances, and where each
+// task definition in use can be placed.
+func (r *capacityReport) summarize() {
+	var wastedCPU, wastedMemory int64
+	placeable := make(map[*taskRequirement]bool)
+
+	for _, instance := range r.Instances {
+		if instance.Status != ecs.ContainerInstanceStatusActive {
+			continue
+		}
+
+		r.Registered.CPU += instance.Registered.CPU
+		r.Registered.Memory += instance.Registered.Memory
+		r.Remaining.CPU += instance.Remaining.CPU
+		r.Remaining.Memory += instance.Remaining.Memory
+
+		if len(r.TasksInUse) == 0 {
+			continue
+		}
+
+		fitting := 0
+		for _, task := range r.TasksInUse {
+			if instance.Remaining.CPU >= task.CPU && instance.Remaining.Memory >= task.Memory {
+				placeable[task] = true
+				fitting++
+			}
+		}
+
+		instance.FitsTasksInUse = fitting == len(r.TasksInUse)
+		if instance.FitsTasksInUse {
+			r.InstancesFitting++
+		}
+
+		if fitting == 0 {
+			wastedCPU += instance.Remaining.CPU
+			wastedMemory += instance.Remaining.Memory
+		}
+	}
+
+	for _, task := range r.TasksInUse {
+		if !placeable[task] {
+			r.Unplaceable = append(r.Unplaceable, task)
+		}
+	}
+
+	if r.Remaining.CPU > 0 {
+		r.Fragmentation.CPU = percent(wastedCPU, r.Remaining.CPU)
+	}
+
+	if r.Remaining.Memory > 0 {
+		r.Fragmentation.Memory = percent(wastedMemory, r.Remaining.Memory)
+	}
+}
+
+// printSummary prints the cluster totals, after the instances table
+func (r *capacityReport) printSummary() {
+	active := 0
+	for _, instance := range r.Instances {
+		if instance.Status == ecs.ContainerInstanceStatusActive {
+			active++
+		}
+	}
+
+	fmt.Printf("\nCluster %s: %d container instances, %d active\n", r.Cluster, len(r.Instances), active)
+	fmt.Printf("CPU:     %s, %d free\n", usage(r.Registered.CPU-r.Remaining.CPU, r.Registered.CPU), r.Remaining.CPU)
+	fmt.Printf("Memory:  %s MiB, %d MiB free\n", usage(r.Registered.Memory-r.Remaining.Memory, r.Registered.Memory), r.Remaining.Memory)
+
+	if len(r.TasksInUse) == 0 {
+		fmt.Println("Task definitions: no service running on the cluster")
+		return
+	}
+
+	fmt.Printf("Task definitions: %d in use, all of them fit on %d of %d active instances\n",
+		len(r.TasksInUse), r.InstancesFitting, active)
+	fmt.Printf("Fragmentation: %.0f%% of the free CPU and %.0f%% of the free memory can't place any task definition in use\n",
+		r.Fragmentation.CPU, r.Fragmentation.Memory)
+
+	for _, task := range r.Unplaceable {
+		fmt.Fprintf(os.Stderr, "Warning: %s (%d CPU, %d MiB) does not fit on any instance, its new tasks will fail to be placed\n",
+			task.TaskDefinition, task.CPU, task.Memory)
+	}
+}
+
+// describeInstancesCapacity returns the capacity of every container instance,
+// along with the tasks running on them.
+func describeInstancesCapacity(client *ecs.ECS, cluster string) ([]*instanceCapacity, error) {
+	var arns []*string
+
+	listInput := &ecs.ListContainerInstancesInput{Cluster: aws.String(cluster)}
+	err := client.ListContainerInstancesPages(listInput, func(page *ecs.ListContainerInstancesOutput, lastPage bool) bool {
+		arns = append(arns, page.ContainerInstanceArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*instanceCapacity
+	byArn := make(map[string]*instanceCapacity)
+
+	// DescribeContainerInstances accepts up to 100 instances at a time
+	for i := 0; i < len(arns); i += 100 {
+		upperBound := i + 100
+		if upperBound > len(arns) {
+			upperBound = len(arns)
+		}
+
+		description, err := client.DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
+			Cluster:            aws.String(cluster),
+			ContainerInstances: arns[i:upperBound],
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, containerInstance := range description.ContainerInstances {
+			instance := newInstanceCapacity(containerInstance)
+			byArn[aws.StringValue(containerInstance.ContainerInstanceArn)] = instance
+			instances = append(instances, instance)
+		}
+	}
+
+	if err := countInstanceTasks(client, cluster, byArn); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Ec2InstanceId < instances[j].Ec2InstanceId
+	})
+
+	return instances, nil
+}
+
+// newInstanceCapacity returns the capacity of the container instance
+func newInstanceCapacity(containerInstance *ecs.ContainerInstance) *instanceCapacity {
+	instance := &instanceCapacity{
+		ContainerInstance: resourceID(containerInstance.ContainerInstanceArn),
+		Ec2InstanceId:     aws.StringValue(containerInstance.Ec2InstanceId),
+		Status:            aws.StringValue(containerInstance.Status),
+		AgentConnected:    aws.BoolValue(containerInstance.AgentConnected),
+		RunningTasks:      aws.Int64Value(containerInstance.RunningTasksCount),
+		PendingTasks:      aws.Int64Value(containerInstance.PendingTasksCount),
+		Registered:        resourceValues(containerInstance.RegisteredResources),
+		Remaining:         resourceValues(containerInstance.RemainingResources),
+	}
+
+	if containerInstance.VersionInfo != nil {
+		instance.AgentVersion = aws.StringValue(containerInstance.VersionInfo.AgentVersion)
+	}
+
+	for _, attribute := range containerInstance.Attributes {
+		switch aws.StringValue(attribute.Name) {
+		case "ecs.instance-type":
+			instance.InstanceType = aws.StringValue(attribute.Value)
+		case "ecs.availability-zone":
+			instance.AvailabilityZone = aws.StringValue(attribute.Value)
+		}
+	}
+
+	return instance
+}
+
+// countInstanceTasks counts the running tasks of each instance by task definition
+func countInstanceTasks(client *ecs.ECS, cluster string, instances map[string]*instanceCapacity) error {
+	var taskArns []*string
+
+	listTasksInput := &ecs.ListTasksInput{Cluster: aws.String(cluster)}
+	err := client.ListTasksPages(listTasksInput, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		taskArns = append(taskArns, page.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	tasks, err := describeTasks(client, cluster, taskArns)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		// Fargate tasks have no container instance
+		instance, ok := instances[aws.StringValue(task.ContainerInstanceArn)]
+		if !ok {
+			continue
+		}
+
+		name := taskDefinitionName(task.TaskDefinitionArn)
+		if instance.TaskDefinitions == nil {
+			instance.TaskDefinitions = make(map[string]int)
+		}
+		instance.TaskDefinitions[name]++
+
+		if !strings.HasPrefix(aws.StringValue(task.Group), "service:") {
+			if instance.StandaloneTasks == nil {
+				instance.StandaloneTasks = make(map[string]int)
+			}
+			instance.StandaloneTasks[name]++
+		}
+	}
+
+	return nil
+}
+
+// tasksInUse returns what it takes to place each task definition used by a
+// service of the cluster, sorted by name. The Fargate services are left out.
+func tasksInUse(client *ecs.ECS, options *capacityOptions) ([]*taskRequirement, error) {
+	listOptions := &listOptions{awsOptions: options.awsOptions}
+	items, err := listClusterServices(listOptions, &clusterLocation{cluster: options.clusterName})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var tasks []*taskRequirement
+
+	for _, item := range items {
+		if launchType(item.Service) == ecs.LaunchTypeFargate {
+			continue
+		}
+
+		arn := aws.StringValue(item.TaskDefinition)
+		if seen[arn] {
+			continue
+		}
+		seen[arn] = true
+
+		taskDefinition, _, err := describeTaskDefinition(client, arn)
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, taskDefinitionRequirement(taskDefinition))
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].TaskDefinition < tasks[j].TaskDefinition
+	})
+
+	return tasks, nil
+}
+
+// taskDefinitionRequirement returns the CPU and memory reserved on the instance
+// to place the task: the task level values if set, otherwise the sum of its
+// containers, which reserve their soft memory limit if set.
+func taskDefinitionRequirement(taskDefinition *ecs.TaskDefinition) *taskRequirement {
+	requirement := &taskRequirement{TaskDefinition: taskDefinitionName(taskDefinition.TaskDefinitionArn)}
+
+	for _, container := range taskDefinition.ContainerDefinitions {
+		requirement.CPU += aws.Int64Value(container.Cpu)
+
+		if container.MemoryReservation != nil {
+			requirement.Memory += aws.Int64Value(container.MemoryReservation)
+		} else {
+			requirement.Memory += aws.Int64Value(container.Memory)
+		}
+	}
+
+	if cpu, err := strconv.ParseInt(aws.StringValue(taskDefinition.Cpu), 10, 64); err == nil {
+		requirement.CPU = cpu
+	}
+
+	if memory, err := strconv.ParseInt(aws.StringValue(taskDefinition.Memory), 10, 64); err == nil {
+		requirement.Memory = memory
+	}
+
+	return requirement
+}
+
+// resourceValues returns the CPU and memory out of the container instance resources
+func resourceValues(list []*ecs.Resource) resources {
+	var values resources
+	for _, resource := range list {
+		switch aws.StringValue(resource.Name) {
+		case "CPU":
+			values.CPU = aws.Int64Value(resource.IntegerValue)
+		case "MEMORY":
+			values.Memory = aws.Int64Value(resource.IntegerValue)
+		}
+	}
+
+	return values
+}
+
+// serviceTasks returns the running tasks started by a service, counted by task definition
+func (i *instanceCapacity) serviceTasks() map[string]int {
+	counts := make(map[string]int)
+	for name, count := range i.TaskDefinitions {
+		if count -= i.StandaloneTasks[name]; count > 0 {
+			counts[name] = count
+		}
+	}
+
+	return counts
+}
+
+// taskDefinitionCounts formats the task counts, e.g: api:12 x2, worker:3
+func taskDefinitionCounts(counts map[string]int) string {
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var values []string
+	for _, name := range names {
+		if counts[name] > 1 {
+			values = append(values, fmt.Sprintf("%s x%d", name, counts[name]))
+		} else {
+			values = append(values, name)
+		}
+	}
+
+	return output.Join(values)
+}
+
+// usage formats the used out of the total, e.g: 512/2048 (25%)
+func usage(used int64, total int64) string {
+	if total == 0 {
+		return fmt.Sprintf("%d/%d", used, total)
+	}
+
+	return fmt.Sprintf("%d/%d (%.0f%%)", used, total, percent(used, total))
+}
+
+func percent(value int64, total int64) float64 {
+	return float64(value) * 100 / float64(total)
+}
+
+// CapacityCommand returns the `aws-ecs capacity` command, which reports the free
+// capacity of the container instances and whether new tasks can be placed.
+func CapacityCommand() *cobra.Command {
+	var options capacityOptions
+
+	cmd := &cobra.Command{
+		Use:   "capacity <cluster>",
+		Short: "Report the CPU and memory capacity of the ECS container instances",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("Invalid number of arguments for aws-ecs capacity command. Use --help for details")
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			options.clusterName = args[0]
+			return reportCapacity(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	options.output.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
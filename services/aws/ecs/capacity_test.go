@@ -0,0 +1,104 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestSummarizeTasksInUse(t *testing.T) {
+	cpuHeavy := &taskRequirement{TaskDefinition: "worker:3", resources: resources{CPU: 2048, Memory: 512}}
+	memoryHeavy := &taskRequirement{TaskDefinition: "cache:1", resources: resources{CPU: 256, Memory: 4096}}
+
+	tests := []struct {
+		name            string
+		free            []resources
+		tasks           []*taskRequirement
+		wantFits        []bool
+		wantFitting     int
+		wantUnplaceable []string
+		wantCPU         float64
+		wantMemory      float64
+	}{
+		{
+			name:     "no task definition in use",
+			free:     []resources{{CPU: 1024, Memory: 1024}},
+			wantFits: []bool{false},
+		},
+		{
+			name:        "each task definition fits somewhere",
+			free:        []resources{{CPU: 2048, Memory: 1024}, {CPU: 512, Memory: 4096}},
+			tasks:       []*taskRequirement{cpuHeavy, memoryHeavy},
+			wantFits:    []bool{false, false},
+			wantFitting: 0,
+		},
+		{
+			name:        "an instance fits every task definition",
+			free:        []resources{{CPU: 2048, Memory: 4096}, {CPU: 512, Memory: 4096}},
+			tasks:       []*taskRequirement{cpuHeavy, memoryHeavy},
+			wantFits:    []bool{true, false},
+			wantFitting: 1,
+		},
+		{
+			name:            "a task definition fits nowhere",
+			free:            []resources{{CPU: 1024, Memory: 7168}, {CPU: 1024, Memory: 1024}},
+			tasks:           []*taskRequirement{cpuHeavy, memoryHeavy},
+			wantFits:        []bool{false, false},
+			wantUnplaceable: []string{"worker:3"},
+			wantCPU:         50,
+			wantMemory:      12.5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := &capacityReport{TasksInUse: test.tasks}
+			for _, free := range test.free {
+				report.Instances = append(report.Instances, &instanceCapacity{Status: ecs.ContainerInstanceStatusActive, Remaining: free})
+			}
+
+			report.summarize()
+
+			var fits []bool
+			for _, instance := range report.Instances {
+				fits = append(fits, instance.FitsTasksInUse)
+			}
+
+			var unplaceable []string
+			for _, task := range report.Unplaceable {
+				unplaceable = append(unplaceable, task.TaskDefinition)
+			}
+
+			if !reflect.DeepEqual(fits, test.wantFits) {
+				t.Errorf("fits = %v, want %v", fits, test.wantFits)
+			}
+			if report.InstancesFitting != test.wantFitting {
+				t.Errorf("InstancesFitting = %d, want %d", report.InstancesFitting, test.wantFitting)
+			}
+			if !reflect.DeepEqual(unplaceable, test.wantUnplaceable) {
+				t.Errorf("Unplaceable = %q, want %q", unplaceable, test.wantUnplaceable)
+			}
+			if report.Fragmentation.CPU != test.wantCPU || report.Fragmentation.Memory != test.wantMemory {
+				t.Errorf("Fragmentation = %.1f%%, %.1f%%, want %.1f%%, %.1f%%",
+					report.Fragmentation.CPU, report.Fragmentation.Memory, test.wantCPU, test.wantMemory)
+			}
+		})
+	}
+}
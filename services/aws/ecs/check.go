@@ -0,0 +1,382 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// checkOptions defines the options used on the `aws-ecs check` command
+type checkOptions struct {
+
+	// cluster running the services
+	clusterName string `type:"string" required:"true"`
+
+	// services to check, every service of the cluster when empty
+	serviceNames []string `type:"[]string" required:"false"`
+
+	// select the services to check, see the `aws-ecs list` filter
+	filter string `type:"string" required:"false"`
+
+	// the parsed filter expression
+	serviceFilter serviceFilter `type:"serviceFilter" required:"false"`
+
+	// how far back failed tasks make the check fail
+	failedWithin time.Duration `type:"duration" required:"false"`
+
+	// how to print the results
+	output output.Options `type:"output.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// checkResult is the result of one check of one service
+type checkResult struct {
+	Service string
+	Check   string
+	Passed  bool
+	Detail  string
+}
+
+// checkColumns defines the table columns of the `aws-ecs check` command
+var checkColumns = []output.Column{
+	{Header: "Service", Value: func(obj interface{}) string {
+		return obj.(*checkResult).Service
+	}},
+	{Header: "Check", Value: func(obj interface{}) string {
+		return obj.(*checkResult).Check
+	}},
+	{Header: "Result", Value: func(obj interface{}) string {
+		if obj.(*checkResult).Passed {
+			return "PASS"
+		}
+		return "FAIL"
+	}},
+	{Header: "Detail", Value: func(obj interface{}) string {
+		return obj.(*checkResult).Detail
+	}},
+}
+
+// checkServices checks the health of the services and fails when any of them is
+// not healthy, so it can gate deployments.
+func checkServices(options *checkOptions) error {
+	services, err := selectServices(&options.awsOptions, options.clusterName, options.serviceNames, options.serviceFilter, true)
+	if err != nil {
+		return err
+	}
+
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	sess, err := awssession.New(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+	elbClient := elbv2.New(sess)
+
+	printer, err := output.NewPrinter(os.Stdout, &options.output, checkColumns)
+	if err != nil {
+		return err
+	}
+
+	var failed, total int
+	since := time.Now().Add(-options.failedWithin)
+
+	for _, service := range services {
+		results, err := checkService(client, elbClient, service, since)
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			total++
+			if !result.Passed {
+				failed++
+			}
+
+			if err := printer.Print(result); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, total)
+	}
+
+	return nil
+}
+
+// checkService runs every check on the service
+func checkService(client *ecs.ECS, elbClient *elbv2.ELBV2, service *ecs.Service, since time.Time) ([]*checkResult, error) {
+	name := aws.StringValue(service.ServiceName)
+	running, desired := aws.Int64Value(service.RunningCount), aws.Int64Value(service.DesiredCount)
+
+	results := []*checkResult{{
+		Service: name,
+		Check:   "running",
+		Passed:  running == desired,
+		Detail:  fmt.Sprintf("%d/%d running", running, desired),
+	}}
+
+	deployment := &checkResult{Service: name, Check: "deployment", Passed: true}
+	if primary := primaryDeployment(service); primary != nil {
+		deployment.Detail = fmt.Sprintf("%s %s", taskDefinitionName(primary.TaskDefinition), aws.StringValue(primary.RolloutState))
+	}
+	if len(service.Deployments) != 1 {
+		deployment.Passed = false
+		deployment.Detail = fmt.Sprintf("%d deployments in progress", len(service.Deployments))
+	} else if aws.StringValue(service.Deployments[0].RolloutState) == ecs.DeploymentRolloutStateFailed {
+		deployment.Passed = false
+	}
+	results = append(results, deployment)
+
+	failedTasks, err := recentlyFailedTasks(client, service, since)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := &checkResult{Service: name, Check: "failed tasks", Passed: len(failedTasks) == 0, Detail: "none"}
+	if len(failedTasks) > 0 {
+		tasks.Detail = fmt.Sprintf("%d since %s: %s", len(failedTasks), since.Local().Format("15:04"), failedTasks[0])
+	}
+	results = append(results, tasks)
+
+	if len(service.LoadBalancers) == 0 {
+		return results, nil
+	}
+
+	targets, err := serviceTargets(client, service)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, loadBalancer := range service.LoadBalancers {
+		if loadBalancer.TargetGroupArn == nil {
+			continue
+		}
+
+		result, err := checkTargetGroup(elbClient, service, targets, loadBalancer.TargetGroupArn)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// recentlyFailedTasks returns why the tasks of the service which failed since the
+// given time stopped. Tasks stopped by deployments or scaling are not failures.
+func recentlyFailedTasks(client *ecs.ECS, service *ecs.Service, since time.Time) ([]string, error) {
+	tasks, err := describeStoppedTasks(client, service, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var reasons []string
+	for _, task := range tasks {
+		if task.StoppedAt == nil || task.StoppedAt.Before(since) || !taskFailed(task) {
+			continue
+		}
+
+		reasons = append(reasons, stoppedTaskMessage(task))
+	}
+
+	return reasons, nil
+}
+
+// taskFailed returns whether the task stopped because something went wrong: it
+// failed to start, an essential container exited or it failed its health checks.
+func taskFailed(task *ecs.Task) bool {
+	switch aws.StringValue(task.StopCode) {
+	case ecs.TaskStopCodeTaskFailedToStart, ecs.TaskStopCodeEssentialContainerExited:
+		return true
+	}
+
+	return strings.Contains(strings.ToLower(aws.StringValue(task.StoppedReason)), "health check")
+}
+
+// serviceTargets returns how the running tasks of the service are registered on
+// their target groups: by IP for the awsvpc network mode, otherwise by EC2
+// instance ID and host port (e.g: i-0123456789abcdef0:32768).
+func serviceTargets(client *ecs.ECS, service *ecs.Service) (map[string]bool, error) {
+	var taskArns []*string
+
+	listTasksInput := &ecs.ListTasksInput{
+		Cluster:     service.ClusterArn,
+		ServiceName: service.ServiceName,
+	}
+
+	err := client.ListTasksPages(listTasksInput, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		taskArns = append(taskArns, page.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := describeTasks(client, aws.StringValue(service.ClusterArn), taskArns)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]bool)
+	containerInstances := make(map[string]string)
+	for _, task := range tasks {
+		if _, ip := taskNetworkInterface(task); ip != "" {
+			targets[ip] = true
+		}
+
+		if task.ContainerInstanceArn != nil {
+			containerInstances[*task.ContainerInstanceArn] = ""
+		}
+	}
+
+	if len(containerInstances) == 0 {
+		return targets, nil
+	}
+
+	if err := describeContainerInstances(client, service.ClusterArn, containerInstances); err != nil {
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		instanceID := containerInstances[aws.StringValue(task.ContainerInstanceArn)]
+		if instanceID == "" {
+			continue
+		}
+
+		for _, container := range task.Containers {
+			for _, binding := range container.NetworkBindings {
+				targets[fmt.Sprintf("%s:%d", instanceID, aws.Int64Value(binding.HostPort))] = true
+			}
+		}
+	}
+
+	return targets, nil
+}
+
+// checkTargetGroup checks that every target of the service on the load balancer
+// target group is healthy (draining targets are leaving, so they're fine). The
+// targets of other services sharing the target group are left out. A service
+// scaled to zero on purpose passes with no target.
+func checkTargetGroup(client *elbv2.ELBV2, service *ecs.Service, targets map[string]bool, targetGroupArn *string) (*checkResult, error) {
+	health, err := client.DescribeTargetHealth(&elbv2.DescribeTargetHealthInput{TargetGroupArn: targetGroupArn})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe the targets of %s: %v", resourceID(targetGroupArn), err)
+	}
+
+	var healthy, total int
+	var unhealthy []string
+	for _, target := range health.TargetHealthDescriptions {
+		id := aws.StringValue(target.Target.Id)
+		if !targets[id] && !targets[fmt.Sprintf("%s:%d", id, aws.Int64Value(target.Target.Port))] {
+			continue
+		}
+
+		state := aws.StringValue(target.TargetHealth.State)
+		switch state {
+		case elbv2.TargetHealthStateEnumDraining:
+			continue
+		case elbv2.TargetHealthStateEnumHealthy:
+			healthy++
+		default:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s %s", id, state))
+		}
+		total++
+	}
+
+	// target group ARNs end with <name>/<id>
+	name := aws.StringValue(targetGroupArn)
+	if parts := strings.Split(name, "/"); len(parts) >= 2 {
+		name = parts[len(parts)-2]
+	}
+
+	scaledToZero := total == 0 && aws.Int64Value(service.DesiredCount) == 0
+	result := &checkResult{
+		Service: aws.StringValue(service.ServiceName),
+		Check:   "target group " + name,
+		Passed:  len(unhealthy) == 0 && (total > 0 || scaledToZero),
+		Detail:  fmt.Sprintf("%d/%d healthy", healthy, total),
+	}
+
+	if len(unhealthy) > 0 {
+		result.Detail += ": " + strings.Join(unhealthy, ", ")
+	} else if scaledToZero {
+		result.Detail = "no target, scaled to 0"
+	}
+
+	return result, nil
+}
+
+// CheckCommand returns the `aws-ecs check` command, which fails when a service is
+// not healthy, to gate pipelines and feed monitors.
+func CheckCommand() *cobra.Command {
+	var options checkOptions
+
+	cmd := &cobra.Command{
+		Use:   "check <cluster> [service...]",
+		Short: "Check the health of ECS services, exiting non-zero when any check fails",
+		Long: "Check the health of ECS services: every desired task is running, a single deployment is in\n" +
+			"progress, no task failed recently and every load balancer target of their tasks is healthy.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("Invalid number of arguments for aws-ecs check command. Use --help for details")
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			serviceFilter, err := parseFilter(options.filter)
+			if err != nil {
+				return err
+			}
+
+			options.serviceFilter = serviceFilter
+			options.clusterName = args[0]
+			options.serviceNames = args[1:]
+			return checkServices(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "", "Check the services matching the filter, see 'aws-ecs list --help'")
+	cmd.PersistentFlags().DurationVarP(&options.failedWithin, "failed-within", "", 10*time.Minute, "Fail when a task failed within this period")
+	options.output.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
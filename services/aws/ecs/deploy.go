@@ -0,0 +1,213 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+)
+
+// deployOptions defines the options used on the `aws-ecs deploy` command
+type deployOptions struct {
+
+	// cluster running the service
+	clusterName string `type:"string" required:"true"`
+
+	// service to deploy
+	serviceName string `type:"string" required:"true"`
+
+	// new image of each container, indexed by container name
+	images map[string]string `type:"map[string]string" required:"true"`
+
+	// how to wait for the deployment
+	wait waitOptions `type:"waitOptions" required:"false"`
+
+	// dry-run and confirmation
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// deployService registers a new revision of the service task definition, with
+// the new images, updates the service and follows the deployment.
+func deployService(options *deployOptions) (err error) {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	service, err := describeService(client, options.clusterName, options.serviceName)
+	if err != nil {
+		return err
+	}
+
+	taskDefinition, tags, err := describeTaskDefinition(client, aws.StringValue(service.TaskDefinition))
+	if err != nil {
+		return err
+	}
+
+	input := registerInput(taskDefinition, tags)
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Deploy service '%s' on cluster '%s'", options.serviceName, options.clusterName),
+	}
+
+	var names []string
+	for name := range options.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		image := options.images[name]
+		container := findContainer(input.ContainerDefinitions, name)
+		if container == nil {
+			return fmt.Errorf("Task definition %s has no container named '%s'",
+				taskDefinitionName(taskDefinition.TaskDefinitionArn), name)
+		}
+
+		plan.Changes = append(plan.Changes, fmt.Sprintf("container '%s': %s -> %s", name, aws.StringValue(container.Image), image))
+		container.Image = aws.String(image)
+	}
+
+	plan.Changes = append(plan.Changes, fmt.Sprintf("register a new revision of %s and update the service",
+		taskDefinitionName(taskDefinition.TaskDefinitionArn)))
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs deploy")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	registered, err := client.RegisterTaskDefinition(input)
+	if err != nil {
+		return fmt.Errorf("Unable to register the new task definition: %v", err)
+	}
+
+	newTaskDefinition := registered.TaskDefinition.TaskDefinitionArn
+	fmt.Printf("Registered task definition %s\n", taskDefinitionName(newTaskDefinition))
+
+	return updateServiceTaskDefinition(client, service, newTaskDefinition, &options.wait, record)
+}
+
+// updateServiceTaskDefinition points the service to the given task definition,
+// and follows the deployment unless asked not to.
+func updateServiceTaskDefinition(client *ecs.ECS, service *ecs.Service, taskDefinition *string, wait *waitOptions, record *audit.Record) error {
+	startedAt := time.Now()
+
+	updated, err := client.UpdateService(&ecs.UpdateServiceInput{
+		Cluster:        service.ClusterArn,
+		Service:        service.ServiceName,
+		TaskDefinition: taskDefinition,
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to update service '%s': %v", aws.StringValue(service.ServiceName), err)
+	}
+	record.Add("updated", 1)
+
+	deployment := primaryDeployment(updated.Service)
+	if wait.noWait || deployment == nil {
+		fmt.Printf("Service '%s' updated to %s\n", aws.StringValue(service.ServiceName), taskDefinitionName(taskDefinition))
+		return nil
+	}
+
+	return waitForDeployment(client, updated.Service, aws.StringValue(deployment.Id), startedAt, wait)
+}
+
+// findContainer returns the container definition with the given name
+func findContainer(containers []*ecs.ContainerDefinition, name string) *ecs.ContainerDefinition {
+	for _, container := range containers {
+		if aws.StringValue(container.Name) == name {
+			return container
+		}
+	}
+
+	return nil
+}
+
+// parseImages parses the container=image arguments of the deploy command
+func parseImages(args []string) (map[string]string, error) {
+	images := make(map[string]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid image '%s', expected container-name=image (e.g: web=nginx:1.19)", arg)
+		}
+
+		if _, ok := images[parts[0]]; ok {
+			return nil, fmt.Errorf("Container '%s' is given more than once", parts[0])
+		}
+
+		images[parts[0]] = parts[1]
+	}
+
+	return images, nil
+}
+
+// DeployCommand returns the `aws-ecs deploy` command, which rolls out new images
+// of the service containers and waits for the deployment to complete.
+func DeployCommand() *cobra.Command {
+	var options deployOptions
+
+	cmd := &cobra.Command{
+		Use:     "deploy <cluster> <service> <container>=<image>...",
+		Short:   "Deploy new container images to an ECS service and wait for the deployment",
+		Example: "  sysadmin-sk aws-ecs deploy prod api web=123456789012.dkr.ecr.us-east-1.amazonaws.com/api:v1.2.3",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 {
+				return errors.New("Invalid number of arguments for aws-ecs deploy command. Use --help for details")
+			}
+
+			images, err := parseImages(args[2:])
+			if err != nil {
+				return err
+			}
+
+			options.clusterName = args[0]
+			options.serviceName = args[1]
+			options.images = images
+			return deployService(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	options.wait.addFlags(cmd.PersistentFlags())
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
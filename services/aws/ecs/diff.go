@@ -0,0 +1,405 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// volatileFields are the task definition fields set by ECS on every revision,
+// they are not part of what the user defines so they're left out of the diff.
+var volatileFields = map[string]bool{
+	"taskDefinitionArn":  true,
+	"revision":           true,
+	"status":             true,
+	"registeredAt":       true,
+	"registeredBy":       true,
+	"deregisteredAt":     true,
+	"requiresAttributes": true,
+	"compatibilities":    true,
+}
+
+// listKeys are the fields identifying the items of a list (e.g: the containers by
+// name, the ports by container port), tried in order. Lists are compared by key,
+// so reordering their items is not a change.
+var listKeys = []string{"name", "containerPort", "containerPath", "sourceContainer"}
+
+// the path prefix of the container fields
+const containersPath = "containerDefinitions["
+
+// the kinds of changes
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// fieldChange is one difference between two task definitions
+type fieldChange struct {
+
+	// Full path of the field, e.g: containerDefinitions[web].image
+	Path string
+
+	// Container of the field, empty for the task definition fields
+	Container string `json:",omitempty"`
+
+	// Path of the field within the container (or task definition)
+	Field string
+
+	// Whether the field was added, removed or changed
+	Change string
+
+	// The field values, nil when the field was added or removed
+	From interface{} `json:",omitempty"`
+	To   interface{} `json:",omitempty"`
+}
+
+// newFieldChange returns the change of the field at path
+func newFieldChange(path string, from interface{}, to interface{}) *fieldChange {
+	change := &fieldChange{Path: path, Field: path, From: from, To: to, Change: changeChanged}
+
+	if strings.HasPrefix(path, containersPath) {
+		if end := strings.Index(path, "]"); end > 0 {
+			change.Container = path[len(containersPath):end]
+			change.Field = strings.TrimPrefix(path[end+1:], ".")
+		}
+	}
+
+	switch {
+	case from == nil:
+		change.Change = changeAdded
+	case to == nil:
+		change.Change = changeRemoved
+	}
+
+	return change
+}
+
+// String returns the change as a +, - or ~ line
+func (c *fieldChange) String() string {
+	switch c.Change {
+	case changeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, diffValue(c.To))
+	case changeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, diffValue(c.From))
+	}
+
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, diffValue(c.From), diffValue(c.To))
+}
+
+// taskDefinitionDocument returns the task definition as found on the AWS API and
+// CLI (e.g: containerDefinitions[].image), which is also how local files are read.
+func taskDefinitionDocument(taskDefinition *ecs.TaskDefinition) (map[string]interface{}, error) {
+	return awsDocument(taskDefinition)
+}
+
+// awsDocument returns the object as found on the AWS API and CLI, e.g: with the
+// serviceName key rather than ServiceName. The numbers are float64, as if the
+// document was read from a JSON file.
+func awsDocument(obj interface{}) (map[string]interface{}, error) {
+	content, err := json.Marshal(apiValue(reflect.ValueOf(obj)))
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// apiValue converts an SDK value to plain maps and lists, keyed by the
+// locationName of the struct fields. Unset fields are left out.
+func apiValue(value reflect.Value) interface{} {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		// timestamps are sent as seconds since the epoch by the API
+		if timestamp, ok := value.Interface().(time.Time); ok {
+			return float64(timestamp.UnixNano()) / float64(time.Second)
+		}
+
+		fields := make(map[string]interface{})
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if field.PkgPath != "" || field.Name == "_" {
+				continue
+			}
+
+			name := field.Tag.Get("locationName")
+			if name == "" {
+				name = field.Name
+			}
+
+			if item := apiValue(value.Field(i)); item != nil {
+				fields[name] = item
+			}
+		}
+		return fields
+
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+
+		// blobs, base64 encoded by encoding/json
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return value.Interface()
+		}
+
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = apiValue(value.Index(i))
+		}
+		return items
+
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+
+		entries := make(map[string]interface{})
+		for _, key := range value.MapKeys() {
+			entries[fmt.Sprint(key.Interface())] = apiValue(value.MapIndex(key))
+		}
+		return entries
+	}
+
+	return value.Interface()
+}
+
+// diffTaskDefinitions returns the changes from one task definition document to
+// another, the container changes sorted after the task definition ones. The
+// documents are normalized in place, see normalizeTaskDefinition.
+func diffTaskDefinitions(from map[string]interface{}, to map[string]interface{}) []*fieldChange {
+	normalizeTaskDefinition(from)
+	normalizeTaskDefinition(to)
+
+	fromFields := make(map[string]interface{})
+	toFields := make(map[string]interface{})
+
+	for key, value := range from {
+		if !volatileFields[key] {
+			flatten(key, value, fromFields)
+		}
+	}
+
+	for key, value := range to {
+		if !volatileFields[key] {
+			flatten(key, value, toFields)
+		}
+	}
+
+	// an item holding its key only is flattened to the item itself, it's not
+	// added nor removed when the other side has fields for that item.
+	var changes []*fieldChange
+	for path, fromValue := range fromFields {
+		toValue, ok := toFields[path]
+		if !ok && !hasFieldsUnder(toFields, path) {
+			changes = append(changes, newFieldChange(path, fromValue, nil))
+		} else if ok && diffValue(fromValue) != diffValue(toValue) {
+			changes = append(changes, newFieldChange(path, fromValue, toValue))
+		}
+	}
+
+	for path, toValue := range toFields {
+		if _, ok := fromFields[path]; !ok && !hasFieldsUnder(fromFields, path) {
+			changes = append(changes, newFieldChange(path, nil, toValue))
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Container != changes[j].Container {
+			return changes[i].Container < changes[j].Container
+		}
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+// normalizeTaskDefinition removes the fields set to the value ECS defaults them
+// to, so a register input file omitting them is not different from the task
+// definition returned by the API (e.g: essential: true, protocol: tcp).
+func normalizeTaskDefinition(document map[string]interface{}) {
+	networkMode, _ := document["networkMode"].(string)
+	if networkMode == ecs.NetworkModeBridge {
+		delete(document, "networkMode")
+	}
+
+	containers, _ := document["containerDefinitions"].([]interface{})
+	for _, item := range containers {
+		container, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if cpu, ok := container["cpu"].(float64); ok && cpu == 0 {
+			delete(container, "cpu")
+		}
+
+		if essential, ok := container["essential"].(bool); ok && essential {
+			delete(container, "essential")
+		}
+
+		mappings, _ := container["portMappings"].([]interface{})
+		for _, item := range mappings {
+			mapping, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			if protocol, ok := mapping["protocol"].(string); ok && protocol == ecs.TransportProtocolTcp {
+				delete(mapping, "protocol")
+			}
+
+			// the host port is set to the container port on the awsvpc and host
+			// network modes, and 0 stands for a dynamic port on the bridge mode
+			hostPort, ok := mapping["hostPort"].(float64)
+			containerPort, _ := mapping["containerPort"].(float64)
+			dynamic := networkMode == "" || networkMode == ecs.NetworkModeBridge
+			if ok && (hostPort == 0 || (!dynamic && hostPort == containerPort)) {
+				delete(mapping, "hostPort")
+			}
+		}
+	}
+}
+
+// flatten adds every scalar value of the document to fields, indexed by its path
+// (e.g: containerDefinitions[web].portMappings[8080].hostPort).
+func flatten(path string, value interface{}, fields map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			flatten(path+"."+key, item, fields)
+		}
+
+	case []interface{}:
+		keyField, keys := listItemKeys(v)
+		if keys == nil {
+			for i, item := range v {
+				flatten(path+"["+fmt.Sprint(i)+"]", item, fields)
+			}
+			return
+		}
+
+		// the key is already part of the path
+		for i, item := range v {
+			itemPath := path + "[" + keys[i] + "]"
+			object := item.(map[string]interface{})
+			if len(object) == 1 {
+				fields[itemPath] = object[keyField]
+			}
+
+			for key, field := range object {
+				if key != keyField {
+					flatten(itemPath+"."+key, field, fields)
+				}
+			}
+		}
+
+	case nil:
+
+	default:
+		fields[path] = v
+	}
+}
+
+// hasFieldsUnder returns whether there are fields nested under the given path
+func hasFieldsUnder(fields map[string]interface{}, path string) bool {
+	for field := range fields {
+		if strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listItemKeys returns the key field of the list and the key of every item, or
+// nil when the items are not objects sharing a field with distinct values.
+func listItemKeys(list []interface{}) (string, []string) {
+	if len(list) == 0 {
+		return "", nil
+	}
+
+	for _, keyField := range listKeys {
+		var keys []string
+		seen := make(map[string]bool)
+
+		for _, item := range list {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return "", nil
+			}
+
+			value, ok := object[keyField]
+			if !ok || value == nil {
+				break
+			}
+
+			key := fmt.Sprint(value)
+			if seen[key] {
+				break
+			}
+
+			seen[key] = true
+			keys = append(keys, key)
+		}
+
+		if len(keys) == len(list) {
+			return keyField, keys
+		}
+	}
+
+	return "", nil
+}
+
+// diffValue formats a value of the diff, as JSON so strings are quoted
+func diffValue(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(content)
+}
+
+// diffLines returns the changes as lines of text, for the confirmation plans
+func diffLines(changes []*fieldChange) []string {
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+
+	return lines
+}
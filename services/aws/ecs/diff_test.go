@@ -0,0 +1,128 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// document parses a JSON task definition, as read from a local file
+func document(t *testing.T, text string) map[string]interface{} {
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestDiffTaskDefinitions(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []string
+	}{
+		{
+			name: "volatile fields are ignored",
+			from: `{"family": "api", "revision": 1, "status": "ACTIVE", "containerDefinitions": [{"name": "web", "image": "api:1"}]}`,
+			to:   `{"family": "api", "revision": 2, "status": "INACTIVE", "containerDefinitions": [{"name": "web", "image": "api:1"}]}`,
+		},
+		{
+			name: "API defaults are not changes",
+			from: `{"family": "api", "networkMode": "awsvpc", "containerDefinitions": [{"name": "web", "image": "api:1", "cpu": 0,
+				"essential": true, "portMappings": [{"containerPort": 80, "hostPort": 80, "protocol": "tcp"}]}]}`,
+			to: `{"family": "api", "networkMode": "awsvpc", "containerDefinitions": [{"name": "web", "image": "api:1",
+				"portMappings": [{"containerPort": 80}]}]}`,
+		},
+		{
+			name: "static host ports on the bridge mode are kept",
+			from: `{"containerDefinitions": [{"name": "web", "portMappings": [{"containerPort": 80, "hostPort": 80}]}]}`,
+			to:   `{"networkMode": "bridge", "containerDefinitions": [{"name": "web", "portMappings": [{"containerPort": 80, "hostPort": 0}]}]}`,
+			want: []string{`- containerDefinitions[web].portMappings[80].hostPort: 80`},
+		},
+		{
+			name: "lists are compared by key",
+			from: `{"containerDefinitions": [{"name": "web", "environment": [{"name": "A", "value": "1"}, {"name": "B", "value": "2"}]}]}`,
+			to:   `{"containerDefinitions": [{"name": "web", "environment": [{"name": "B", "value": "3"}, {"name": "A", "value": "1"}]}]}`,
+			want: []string{`~ containerDefinitions[web].environment[B].value: "2" -> "3"`},
+		},
+		{
+			name: "containers added, removed and changed",
+			from: `{"cpu": "256", "containerDefinitions": [{"name": "web", "image": "api:1"}, {"name": "old", "image": "old:1"}]}`,
+			to:   `{"cpu": "512", "containerDefinitions": [{"name": "web", "image": "api:2"}, {"name": "new", "image": "new:1"}]}`,
+			want: []string{
+				`~ cpu: "256" -> "512"`,
+				`+ containerDefinitions[new].image: "new:1"`,
+				`- containerDefinitions[old].image: "old:1"`,
+				`~ containerDefinitions[web].image: "api:1" -> "api:2"`,
+			},
+		},
+		{
+			name: "lists without key are compared by index",
+			from: `{"containerDefinitions": [{"name": "web", "command": ["run", "--fast"]}]}`,
+			to:   `{"containerDefinitions": [{"name": "web", "command": ["run"]}]}`,
+			want: []string{`- containerDefinitions[web].command[1]: "--fast"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffLines(diffTaskDefinitions(document(t, test.from), document(t, test.to)))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListItemKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     string
+		wantKey  string
+		wantKeys []string
+	}{
+		{name: "empty", list: `[]`},
+		{name: "scalars", list: `["a", "b"]`},
+		{name: "by name", list: `[{"name": "web"}, {"name": "sidecar"}]`, wantKey: "name", wantKeys: []string{"web", "sidecar"}},
+		{name: "by container port", list: `[{"containerPort": 80}, {"containerPort": 443}]`, wantKey: "containerPort", wantKeys: []string{"80", "443"}},
+		{name: "duplicated keys", list: `[{"name": "a"}, {"name": "a"}]`},
+		{name: "missing key", list: `[{"name": "a"}, {"value": "b"}]`},
+		{
+			name:     "falls back to the next key",
+			list:     `[{"sourceContainer": "a", "name": "x"}, {"sourceContainer": "b", "name": "x"}]`,
+			wantKey:  "sourceContainer",
+			wantKeys: []string{"a", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var list []interface{}
+			if err := json.Unmarshal([]byte(test.list), &list); err != nil {
+				t.Fatal(err)
+			}
+
+			key, keys := listItemKeys(list)
+			if key != test.wantKey || !reflect.DeepEqual(keys, test.wantKeys) {
+				t.Errorf("listItemKeys() = %q, %q, want %q, %q", key, keys, test.wantKey, test.wantKeys)
+			}
+		})
+	}
+}
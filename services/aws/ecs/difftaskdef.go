@@ -0,0 +1,209 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// diffOptions defines the options used on the `aws-ecs diff-taskdef` command
+type diffOptions struct {
+
+	// the task definitions to compare: family:revision, ARN, cluster/service or file
+	from string `type:"string" required:"true"`
+	to   string `type:"string" required:"true"`
+
+	// exit with an error when the task definitions differ
+	exitCode bool `type:"bool" required:"false"`
+
+	// how to print the changes
+	output output.Options `type:"output.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// changeColumns defines the table columns of the `aws-ecs diff-taskdef` command
+var changeColumns = []output.Column{
+	{Header: "Container", Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*fieldChange).Container)
+	}},
+	{Header: "Field", Value: func(obj interface{}) string {
+		return obj.(*fieldChange).Field
+	}},
+	{Header: "Change", Value: func(obj interface{}) string {
+		return obj.(*fieldChange).Change
+	}},
+	{Header: "From", Value: func(obj interface{}) string {
+		return displayValue(obj.(*fieldChange).From)
+	}},
+	{Header: "To", Value: func(obj interface{}) string {
+		return displayValue(obj.(*fieldChange).To)
+	}},
+}
+
+// diffTaskDefinitionsCommand prints what changes from one task definition to another
+func diffTaskDefinitionsCommand(options *diffOptions) error {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	from, err := loadTaskDefinition(client, options.from)
+	if err != nil {
+		return err
+	}
+
+	to, err := loadTaskDefinition(client, options.to)
+	if err != nil {
+		return err
+	}
+
+	changes := diffTaskDefinitions(from, to)
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stderr, "No differences between %s and %s\n", options.from, options.to)
+		return nil
+	}
+
+	printer, err := output.NewPrinter(os.Stdout, &options.output, changeColumns)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if err := printer.Print(change); err != nil {
+			return err
+		}
+	}
+
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+
+	if options.exitCode {
+		return fmt.Errorf("%s and %s differ", options.from, options.to)
+	}
+
+	return nil
+}
+
+// loadTaskDefinition returns the task definition document the reference points
+// to: a local JSON file, the live task definition of a cluster/service, or a
+// task definition family:revision or ARN.
+func loadTaskDefinition(client *ecs.ECS, reference string) (map[string]interface{}, error) {
+	if stat, err := os.Stat(reference); err == nil && !stat.IsDir() {
+		return readTaskDefinitionFile(reference)
+	}
+
+	taskDefinition := reference
+	if strings.Contains(reference, "/") && !strings.HasPrefix(reference, "arn:") {
+		parts := strings.SplitN(reference, "/", 2)
+
+		service, err := describeService(client, parts[0], parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		taskDefinition = aws.StringValue(service.TaskDefinition)
+	}
+
+	description, _, err := describeTaskDefinition(client, taskDefinition)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to describe task definition %s: %v", taskDefinition, err)
+	}
+
+	return taskDefinitionDocument(description)
+}
+
+// readTaskDefinitionFile reads a task definition from a local JSON file, either
+// the input of `aws ecs register-task-definition` or the output of `aws ecs
+// describe-task-definition`.
+func readTaskDefinitionFile(path string) (map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("Invalid task definition file %s: %v", path, err)
+	}
+
+	if taskDefinition, ok := document["taskDefinition"].(map[string]interface{}); ok {
+		return taskDefinition, nil
+	}
+
+	return document, nil
+}
+
+// displayValue formats a value on the table, without quoting strings
+func displayValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+
+	return diffValue(value)
+}
+
+// DiffTaskDefinitionCommand returns the `aws-ecs diff-taskdef` command, which shows
+// what changes between two task definitions.
+func DiffTaskDefinitionCommand() *cobra.Command {
+	var options diffOptions
+
+	cmd := &cobra.Command{
+		Use:   "diff-taskdef <from> <to>",
+		Short: "Show what changes between two task definitions",
+		Long: "Show what changes between two task definitions, container by container. Each task definition\n" +
+			"is either a family:revision, an ARN, the live task definition of a service as <cluster>/<service>,\n" +
+			"or a local JSON file.",
+		Example: "  sysadmin-sk aws-ecs diff-taskdef api:12 api:13\n" +
+			"  sysadmin-sk aws-ecs diff-taskdef prod/api taskdef.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("Invalid number of arguments for aws-ecs diff-taskdef command. Use --help for details")
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			options.from = args[0]
+			options.to = args[1]
+			return diffTaskDefinitionsCommand(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	options.output.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().BoolVarP(&options.exitCode, "exit-code", "", false, "Exit with an error when the task definitions differ")
+	return cmd
+}
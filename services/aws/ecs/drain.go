@@ -0,0 +1,359 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+)
+
+// drainOptions defines the options used on the `aws-ecs drain` command
+type drainOptions struct {
+
+	// cluster of the container instances
+	clusterName string `type:"string" required:"true"`
+
+	// instances to drain, by EC2 instance ID or container instance ID
+	instances []string `type:"[]string" required:"true"`
+
+	// drain even when the tasks may not fit on the other instances
+	force bool `type:"bool" required:"false"`
+
+	// return as soon as the instances are draining
+	noWait bool `type:"bool" required:"false"`
+
+	// how long to wait for the tasks to leave the instances
+	timeout time.Duration `type:"duration" required:"false"`
+
+	// dry-run and confirmation
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// drainInstances sets the container instances to DRAINING, after checking their
+// tasks can be placed elsewhere, and waits until no task runs on them.
+func drainInstances(options *drainOptions) (err error) {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	instances, err := describeInstancesCapacity(client, options.clusterName)
+	if err != nil {
+		return err
+	}
+
+	draining, others, err := splitDrainingInstances(instances, options.instances)
+	if err != nil {
+		return err
+	}
+
+	requirements, err := drainingRequirements(client, draining)
+	if err != nil {
+		return err
+	}
+	unplaced := checkHeadroom(draining, others, requirements)
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Drain %d container instances of cluster '%s'", len(draining), options.clusterName),
+	}
+
+	for _, instance := range draining {
+		serviceTasks := instance.serviceTasks()
+		plan.Changes = append(plan.Changes, fmt.Sprintf("%s: set to DRAINING, %d service tasks to move (%s)",
+			instance.Ec2InstanceId, taskCount(serviceTasks), taskDefinitionCounts(serviceTasks)))
+
+		// draining only replaces the service tasks, the other ones keep running
+		if len(instance.StandaloneTasks) > 0 {
+			plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %d standalone tasks are not moved, the drain completes once they exit (%s)",
+				instance.Ec2InstanceId, taskCount(instance.StandaloneTasks), taskDefinitionCounts(instance.StandaloneTasks)))
+		}
+	}
+
+	if len(unplaced) > 0 {
+		message := fmt.Sprintf("not enough headroom on the other instances for: %s", strings.Join(unplaced, ", "))
+		if !options.force {
+			return errors.New("Refusing to drain, " + message + ". Scale the cluster out first or use --force")
+		}
+
+		plan.Changes = append(plan.Changes, "WARNING: "+message)
+	}
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs drain")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	var arns []*string
+	for _, instance := range draining {
+		arns = append(arns, aws.String(instance.ContainerInstance))
+	}
+
+	// UpdateContainerInstancesState accepts up to 10 instances at a time
+	for i := 0; i < len(arns); i += 10 {
+		upperBound := i + 10
+		if upperBound > len(arns) {
+			upperBound = len(arns)
+		}
+
+		updated, err := client.UpdateContainerInstancesState(&ecs.UpdateContainerInstancesStateInput{
+			Cluster:            aws.String(options.clusterName),
+			ContainerInstances: arns[i:upperBound],
+			Status:             aws.String(ecs.ContainerInstanceStatusDraining),
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to drain the container instances: %v", err)
+		}
+
+		for _, failure := range updated.Failures {
+			return fmt.Errorf("Unable to drain container instance %s: %s",
+				resourceID(failure.Arn), aws.StringValue(failure.Reason))
+		}
+
+		record.Add("drained", int64(len(updated.ContainerInstances)))
+	}
+
+	if options.noWait {
+		fmt.Println("Container instances are draining")
+		return nil
+	}
+
+	return waitForDrain(client, options, arns)
+}
+
+// splitDrainingInstances returns the instances to drain, and the other active
+// instances which will receive their tasks.
+func splitDrainingInstances(instances []*instanceCapacity, names []string) ([]*instanceCapacity, []*instanceCapacity, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[resourceID(aws.String(name))] = true
+	}
+
+	var draining, others []*instanceCapacity
+	for _, instance := range instances {
+		switch {
+		case wanted[instance.Ec2InstanceId] || wanted[instance.ContainerInstance]:
+			delete(wanted, instance.Ec2InstanceId)
+			delete(wanted, instance.ContainerInstance)
+			draining = append(draining, instance)
+		case instance.Status == ecs.ContainerInstanceStatusActive:
+			others = append(others, instance)
+		}
+	}
+
+	for name := range wanted {
+		return nil, nil, fmt.Errorf("Unable to find container instance '%s' on the cluster", name)
+	}
+
+	return draining, others, nil
+}
+
+// drainingRequirements returns the requirements of the service tasks running on
+// the draining instances, indexed by task definition.
+func drainingRequirements(client *ecs.ECS, draining []*instanceCapacity) (map[string]*taskRequirement, error) {
+	requirements := make(map[string]*taskRequirement)
+
+	for _, instance := range draining {
+		for name := range instance.serviceTasks() {
+			if _, ok := requirements[name]; ok {
+				continue
+			}
+
+			taskDefinition, _, err := describeTaskDefinition(client, name)
+			if err != nil {
+				return nil, err
+			}
+
+			requirements[name] = taskDefinitionRequirement(taskDefinition)
+		}
+	}
+
+	return requirements, nil
+}
+
+// checkHeadroom places, largest first, the service tasks of the draining instances
+// on the free capacity of the other instances, and returns the tasks that didn't
+// fit. That's an estimate, ECS placement strategies and constraints are not
+// simulated, and the standalone tasks are left out as draining does not move them.
+func checkHeadroom(draining []*instanceCapacity, others []*instanceCapacity, requirements map[string]*taskRequirement) []string {
+	var tasks []*taskRequirement
+
+	for _, instance := range draining {
+		for name, count := range instance.serviceTasks() {
+			for i := 0; i < count; i++ {
+				tasks = append(tasks, requirements[name])
+			}
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].CPU != tasks[j].CPU {
+			return tasks[i].CPU > tasks[j].CPU
+		}
+		if tasks[i].Memory != tasks[j].Memory {
+			return tasks[i].Memory > tasks[j].Memory
+		}
+		return tasks[i].TaskDefinition < tasks[j].TaskDefinition
+	})
+
+	free := make([]resources, len(others))
+	for i, instance := range others {
+		free[i] = instance.Remaining
+	}
+
+	unplaced := make(map[string]int)
+	for _, task := range tasks {
+		placed := false
+		for i := range free {
+			if free[i].CPU >= task.CPU && free[i].Memory >= task.Memory {
+				free[i].CPU -= task.CPU
+				free[i].Memory -= task.Memory
+				placed = true
+				break
+			}
+		}
+
+		if !placed {
+			unplaced[task.TaskDefinition]++
+		}
+	}
+
+	var names []string
+	for name, count := range unplaced {
+		names = append(names, fmt.Sprintf("%d task(s) of %s", count, name))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// taskCount returns the total of the task counts
+func taskCount(counts map[string]int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	return total
+}
+
+// waitForDrain waits until no task runs on the draining instances
+func waitForDrain(client *ecs.ECS, options *drainOptions, arns []*string) error {
+	deadline := time.Now().Add(options.timeout)
+	var lastStatus string
+
+	for {
+		var instances []*ecs.ContainerInstance
+
+		// DescribeContainerInstances accepts up to 100 instances at a time
+		for i := 0; i < len(arns); i += 100 {
+			upperBound := i + 100
+			if upperBound > len(arns) {
+				upperBound = len(arns)
+			}
+
+			description, err := client.DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
+				Cluster:            aws.String(options.clusterName),
+				ContainerInstances: arns[i:upperBound],
+			})
+			if err != nil {
+				return err
+			}
+
+			instances = append(instances, description.ContainerInstances...)
+		}
+
+		var remaining int64
+		var statuses []string
+		for _, instance := range instances {
+			count := aws.Int64Value(instance.RunningTasksCount) + aws.Int64Value(instance.PendingTasksCount)
+			remaining += count
+			statuses = append(statuses, fmt.Sprintf("%s: %d", aws.StringValue(instance.Ec2InstanceId), count))
+		}
+		sort.Strings(statuses)
+
+		if status := strings.Join(statuses, ", "); status != lastStatus {
+			fmt.Printf("%s  tasks left %s\n", time.Now().Format("15:04:05"), status)
+			lastStatus = status
+		}
+
+		if remaining == 0 {
+			fmt.Println("Container instances drained, no task running on them")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			fmt.Fprintln(os.Stderr, "Check the events of the services with `aws-ecs events` to find out why tasks are not moving")
+			return fmt.Errorf("Timed out waiting for the container instances to drain, %d tasks left", remaining)
+		}
+
+		time.Sleep(waitInterval)
+	}
+}
+
+// DrainCommand returns the `aws-ecs drain` command, which moves the tasks out of
+// container instances, e.g: before patching or replacing them.
+func DrainCommand() *cobra.Command {
+	var options drainOptions
+
+	cmd := &cobra.Command{
+		Use:     "drain <cluster> <instance>...",
+		Short:   "Drain ECS container instances, waiting for their tasks to move",
+		Example: "  sysadmin-sk aws-ecs drain prod i-0123456789abcdef0 i-0fedcba9876543210",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("Invalid number of arguments for aws-ecs drain command. Use --help for details")
+			}
+
+			options.clusterName = args[0]
+			options.instances = args[1:]
+			return drainInstances(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().BoolVarP(&options.force, "force", "", false, "Drain even when the tasks may not fit on the other instances")
+	cmd.PersistentFlags().BoolVarP(&options.noWait, "no-wait", "", false, "Do not wait for the tasks to leave the instances")
+	cmd.PersistentFlags().DurationVarP(&options.timeout, "timeout", "", 30*time.Minute, "How long to wait for the tasks to leave the instances")
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
@@ -0,0 +1,85 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckHeadroom(t *testing.T) {
+	requirements := map[string]*taskRequirement{
+		"api:1":    {TaskDefinition: "api:1", resources: resources{CPU: 512, Memory: 1024}},
+		"worker:3": {TaskDefinition: "worker:3", resources: resources{CPU: 1024, Memory: 512}},
+		"cron:7":   {TaskDefinition: "cron:7", resources: resources{CPU: 2048, Memory: 4096}},
+	}
+
+	tests := []struct {
+		name     string
+		draining []*instanceCapacity
+		free     []resources
+		want     []string
+	}{
+		{
+			name:     "every task fits",
+			draining: []*instanceCapacity{{TaskDefinitions: map[string]int{"api:1": 2, "worker:3": 1}}},
+			free:     []resources{{CPU: 2048, Memory: 2048}, {CPU: 512, Memory: 1024}},
+		},
+		{
+			name:     "largest tasks are placed first",
+			draining: []*instanceCapacity{{TaskDefinitions: map[string]int{"api:1": 2, "worker:3": 1}}},
+			free:     []resources{{CPU: 1024, Memory: 1024}, {CPU: 512, Memory: 1024}},
+			want:     []string{"1 task(s) of api:1"},
+		},
+		{
+			name:     "no other instance",
+			draining: []*instanceCapacity{{TaskDefinitions: map[string]int{"api:1": 2}}, {TaskDefinitions: map[string]int{"worker:3": 1}}},
+			want:     []string{"1 task(s) of worker:3", "2 task(s) of api:1"},
+		},
+		{
+			name: "standalone tasks are not moved",
+			draining: []*instanceCapacity{{
+				TaskDefinitions: map[string]int{"api:1": 1, "cron:7": 1},
+				StandaloneTasks: map[string]int{"cron:7": 1},
+			}},
+			free: []resources{{CPU: 512, Memory: 1024}},
+		},
+		{
+			name: "service tasks sharing a standalone task definition",
+			draining: []*instanceCapacity{{
+				TaskDefinitions: map[string]int{"api:1": 3},
+				StandaloneTasks: map[string]int{"api:1": 1},
+			}},
+			free: []resources{{CPU: 1024, Memory: 1024}},
+			want: []string{"1 task(s) of api:1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var others []*instanceCapacity
+			for _, free := range test.free {
+				others = append(others, &instanceCapacity{Remaining: free})
+			}
+
+			got := checkHeadroom(test.draining, others, requirements)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("checkHeadroom() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+)
+
+// eventsOptions defines the options used on the `aws-ecs events` command
+type eventsOptions struct {
+
+	// cluster running the services
+	clusterName string `type:"string" required:"true"`
+
+	// services to show the events of
+	serviceNames []string `type:"[]string" required:"true"`
+
+	// how far back to show events from
+	since time.Duration `type:"duration" required:"false"`
+
+	// keep showing new events until interrupted
+	follow bool `type:"bool" required:"false"`
+
+	// do not show the stopped tasks
+	noStoppedTasks bool `type:"bool" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// serviceEvent is one line of the `aws-ecs events` command, either a service
+// event or a stopped task.
+type serviceEvent struct {
+	time    time.Time
+	service string
+	message string
+}
+
+// eventsTracker remembers what was already printed, so following the events
+// only prints the new ones.
+type eventsTracker struct {
+	seen map[string]bool
+}
+
+// showEvents prints the service events and stopped tasks, oldest first
+func showEvents(options *eventsOptions) error {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	tracker := &eventsTracker{seen: make(map[string]bool)}
+	since := time.Now().Add(-options.since)
+
+	for {
+		events, err := tracker.poll(client, options, since)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			fmt.Printf("%s  %-20s  %s\n", event.time.Local().Format("2006-01-02 15:04:05"), event.service, event.message)
+		}
+
+		if !options.follow {
+			return nil
+		}
+
+		time.Sleep(waitInterval)
+	}
+}
+
+// poll returns the events of every service not printed yet, sorted by time
+func (t *eventsTracker) poll(client *ecs.ECS, options *eventsOptions, since time.Time) ([]*serviceEvent, error) {
+	var events []*serviceEvent
+
+	for _, name := range options.serviceNames {
+		service, err := describeService(client, options.clusterName, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range service.Events {
+			id := aws.StringValue(event.Id)
+			if t.seen[id] || aws.TimeValue(event.CreatedAt).Before(since) {
+				continue
+			}
+
+			t.seen[id] = true
+			events = append(events, &serviceEvent{
+				time:    aws.TimeValue(event.CreatedAt),
+				service: name,
+				message: aws.StringValue(event.Message),
+			})
+		}
+
+		if options.noStoppedTasks {
+			continue
+		}
+
+		stopped, err := t.stoppedTasks(client, service, since)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, stopped...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+
+	return events, nil
+}
+
+// stoppedTasks returns the tasks of the service which stopped since the given
+// time, with why they stopped.
+func (t *eventsTracker) stoppedTasks(client *ecs.ECS, service *ecs.Service, since time.Time) ([]*serviceEvent, error) {
+	tasks, err := describeStoppedTasks(client, service, t.seen)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*serviceEvent
+	for _, task := range tasks {
+		// tasks still stopping are picked up once they're stopped
+		if task.StoppedAt == nil {
+			continue
+		}
+
+		t.seen[aws.StringValue(task.TaskArn)] = true
+		if task.StoppedAt.Before(since) {
+			continue
+		}
+
+		events = append(events, &serviceEvent{
+			time:    aws.TimeValue(task.StoppedAt),
+			service: aws.StringValue(service.ServiceName),
+			message: stoppedTaskMessage(task),
+		})
+	}
+
+	return events, nil
+}
+
+// describeStoppedTasks returns the stopped tasks of the service, except the ones
+// in skip (indexed by ARN). ECS keeps the stopped tasks for about an hour.
+func describeStoppedTasks(client *ecs.ECS, service *ecs.Service, skip map[string]bool) ([]*ecs.Task, error) {
+	var taskArns []*string
+
+	listTasksInput := &ecs.ListTasksInput{
+		Cluster:       service.ClusterArn,
+		ServiceName:   service.ServiceName,
+		DesiredStatus: aws.String(ecs.DesiredStatusStopped),
+	}
+
+	err := client.ListTasksPages(listTasksInput, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		for _, arn := range page.TaskArns {
+			if !skip[aws.StringValue(arn)] {
+				taskArns = append(taskArns, arn)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return describeTasks(client, aws.StringValue(service.ClusterArn), taskArns)
+}
+
+// stoppedTaskMessage describes why the task stopped, along with the exit code
+// and reason of each of its containers.
+func stoppedTaskMessage(task *ecs.Task) string {
+	_, revision := splitTaskDefinition(task.TaskDefinitionArn)
+	message := fmt.Sprintf("(task %s, revision %d) stopped: %s", resourceID(task.TaskArn), revision,
+		aws.StringValue(task.StoppedReason))
+
+	var containers []string
+	for _, container := range task.Containers {
+		status := aws.StringValue(container.Name)
+		if container.ExitCode != nil {
+			status += fmt.Sprintf(" exit %d", aws.Int64Value(container.ExitCode))
+		}
+
+		if container.Reason != nil {
+			status += ": " + aws.StringValue(container.Reason)
+		}
+
+		containers = append(containers, status)
+	}
+
+	if len(containers) > 0 {
+		message += " [" + strings.Join(containers, ", ") + "]"
+	}
+
+	return message
+}
+
+// EventsCommand returns the `aws-ecs events` command, which shows the events of
+// the services along with the tasks that stopped and why.
+func EventsCommand() *cobra.Command {
+	var options eventsOptions
+
+	cmd := &cobra.Command{
+		Use:     "events <cluster> <service>...",
+		Short:   "Show the events and stopped tasks of ECS services",
+		Example: "  sysadmin-sk aws-ecs events prod api worker --follow",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("Invalid number of arguments for aws-ecs events command. Use --help for details")
+			}
+
+			options.clusterName = args[0]
+			options.serviceNames = args[1:]
+			return showEvents(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().DurationVarP(&options.since, "since", "s", time.Hour, "Show the events newer than this (e.g: 30m, 2h)")
+	cmd.PersistentFlags().BoolVarP(&options.follow, "follow", "f", false, "Keep showing new events until interrupted")
+	cmd.PersistentFlags().BoolVarP(&options.noStoppedTasks, "no-stopped-tasks", "", false, "Do not show the stopped tasks")
+	return cmd
+}
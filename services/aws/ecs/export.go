@@ -0,0 +1,277 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/applicationautoscaling"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// serviceReadOnlyFields are the service fields reporting its state, rather than
+// its configuration, left out of the export so it only changes on actual drift.
+var serviceReadOnlyFields = []string{
+	"serviceArn", "clusterArn", "status", "runningCount", "pendingCount", "deployments",
+	"events", "createdAt", "createdBy", "taskSets", "platformFamily",
+}
+
+var invalidFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// exportOptions defines the options used on the `aws-ecs export` command
+type exportOptions struct {
+
+	// cluster to export the services of
+	clusterName string `type:"string" required:"true"`
+
+	// directory to write the files to, defaults to the cluster name
+	directory string `type:"string" required:"false"`
+
+	// select the services to export, see the `aws-ecs list` filter
+	filter string `type:"string" required:"false"`
+
+	// the parsed filter expression
+	serviceFilter serviceFilter `type:"serviceFilter" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// exportServices writes one YAML file per service, with the service and task
+// definition configuration.
+func exportServices(options *exportOptions) error {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	listOptions := &listOptions{serviceFilter: options.serviceFilter, awsOptions: options.awsOptions}
+	items, err := listClusterServices(listOptions, &clusterLocation{cluster: options.clusterName})
+	if err != nil {
+		return err
+	}
+
+	// the export still works without the Application Auto Scaling permissions
+	autoScaled, err := autoScaledServices(&options.awsOptions, options.clusterName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to list the auto-scaled services, their desired count is exported: %v\n", err)
+	}
+
+	if err := os.MkdirAll(options.directory, 0755); err != nil {
+		return err
+	}
+
+	exported := make(map[string]bool)
+	for _, item := range items {
+		content, err := exportService(client, item.Service, autoScaled[aws.StringValue(item.ServiceName)])
+		if err != nil {
+			return fmt.Errorf("Unable to export service '%s': %v", aws.StringValue(item.ServiceName), err)
+		}
+
+		name := invalidFileChars.ReplaceAllString(aws.StringValue(item.ServiceName), "-")
+		path := filepath.Join(options.directory, name+".yaml")
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			return err
+		}
+
+		exported[path] = true
+		fmt.Printf("Exported service '%s' to %s\n", aws.StringValue(item.ServiceName), path)
+	}
+
+	// the files of the deleted services are removed, so they show up as drift.
+	// With a filter, the other files belong to services which were not selected.
+	if len(options.serviceFilter) == 0 {
+		if err := removeStaleFiles(options.directory, resourceID(aws.String(options.clusterName)), exported); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Exported %d services of cluster '%s'\n", len(items), options.clusterName)
+	return nil
+}
+
+// removeStaleFiles removes the files of the cluster services which were not
+// exported. The other YAML files, including the exports of other clusters, are
+// left alone.
+func removeStaleFiles(directory string, cluster string, exported map[string]bool) error {
+	paths, err := filepath.Glob(filepath.Join(directory, "*.yaml"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if exported[path] {
+			continue
+		}
+
+		if exportCluster, ok := exportedCluster(path); !ok || exportCluster != cluster {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s, the service no longer exists\n", path)
+	}
+
+	return nil
+}
+
+// exportedCluster returns the cluster of a file written by exportService, false
+// if the file is not a service export.
+func exportedCluster(path string) (string, bool) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return "", false
+	}
+
+	cluster, _ := document["cluster"].(string)
+	_, service := document["service"]
+	_, taskDefinition := document["taskDefinition"]
+	if cluster == "" || !service || !taskDefinition || len(document) != 3 {
+		return "", false
+	}
+
+	return cluster, true
+}
+
+// autoScaledServices returns the names of the services of the cluster whose
+// desired count is managed by Application Auto Scaling.
+func autoScaledServices(options *awssession.Options, cluster string) (map[string]bool, error) {
+	session, err := awssession.New(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// the resource IDs are service/<cluster name>/<service name>
+	prefix := "service/" + cluster[strings.LastIndex(cluster, "/")+1:] + "/"
+
+	services := make(map[string]bool)
+	err = applicationautoscaling.New(session).DescribeScalableTargetsPages(&applicationautoscaling.DescribeScalableTargetsInput{
+		ServiceNamespace: aws.String(applicationautoscaling.ServiceNamespaceEcs),
+	}, func(page *applicationautoscaling.DescribeScalableTargetsOutput, lastPage bool) bool {
+		for _, target := range page.ScalableTargets {
+			resourceID := aws.StringValue(target.ResourceId)
+			if strings.HasPrefix(resourceID, prefix) {
+				services[resourceID[len(prefix):]] = true
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return services, nil
+}
+
+// exportService returns the YAML document of the service and its task definition,
+// with the keys sorted and the empty and read-only fields removed so the files
+// are stable and easy to review. The desired count of the auto-scaled services
+// is left out too, as it changes with the load.
+func exportService(client *ecs.ECS, service *ecs.Service, autoScaled bool) ([]byte, error) {
+	serviceDocument, err := awsDocument(service)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range serviceReadOnlyFields {
+		delete(serviceDocument, field)
+	}
+	if autoScaled {
+		delete(serviceDocument, "desiredCount")
+	}
+	serviceDocument["taskDefinition"] = taskDefinitionName(service.TaskDefinition)
+
+	taskDefinition, tags, err := describeTaskDefinition(client, aws.StringValue(service.TaskDefinition))
+	if err != nil {
+		return nil, err
+	}
+
+	description, err := awsDocument(&ecs.DescribeTaskDefinitionOutput{TaskDefinition: taskDefinition, Tags: tags})
+	if err != nil {
+		return nil, err
+	}
+
+	taskDefinitionDocument, _ := description["taskDefinition"].(map[string]interface{})
+	for field := range volatileFields {
+		delete(taskDefinitionDocument, field)
+	}
+	taskDefinitionDocument["tags"] = description["tags"]
+
+	document, err := output.Prune(map[string]interface{}{
+		"cluster":        resourceID(service.ClusterArn),
+		"service":        serviceDocument,
+		"taskDefinition": taskDefinitionDocument,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(document)
+}
+
+// ExportCommand returns the `aws-ecs export` command, which writes the services
+// and their task definitions as YAML files, e.g: to track drift on git.
+func ExportCommand() *cobra.Command {
+	var options exportOptions
+
+	cmd := &cobra.Command{
+		Use:     "export <cluster>",
+		Short:   "Export ECS services and their task definitions as YAML, one file per service",
+		Example: "  sysadmin-sk aws-ecs export prod --dir ecs/prod",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("Invalid number of arguments for aws-ecs export command. Use --help for details")
+			}
+
+			serviceFilter, err := parseFilter(options.filter)
+			if err != nil {
+				return err
+			}
+
+			options.serviceFilter = serviceFilter
+			options.clusterName = args[0]
+			if options.directory == "" {
+				options.directory = options.clusterName
+			}
+			return exportServices(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.directory, "dir", "d", "", "Directory to write the files to (default: the cluster name)")
+	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "", "Export the services matching the filter, see 'aws-ecs list --help'")
+	return cmd
+}
@@ -0,0 +1,98 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExportedCluster(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantCluster string
+		wantOK      bool
+	}{
+		{
+			name:        "service export",
+			content:     "cluster: prod\nservice:\n  serviceName: api\ntaskDefinition:\n  family: api\n",
+			wantCluster: "prod",
+			wantOK:      true,
+		},
+		{name: "without cluster", content: "service:\n  serviceName: api\ntaskDefinition:\n  family: api\n"},
+		{name: "other keys", content: "cluster: prod\nservice: {}\ntaskDefinition: {}\nreplicas: 2\n"},
+		{name: "kubernetes manifest", content: "apiVersion: apps/v1\nkind: Deployment\n"},
+		{name: "not YAML", content: "{{"},
+	}
+
+	directory := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(directory, "service.yaml")
+			if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cluster, ok := exportedCluster(path)
+			if cluster != test.wantCluster || ok != test.wantOK {
+				t.Errorf("exportedCluster() = %q, %v, want %q, %v", cluster, ok, test.wantCluster, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestRemoveStaleFiles(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"api.yaml":     "cluster: prod\nservice: {serviceName: api}\ntaskDefinition: {family: api}\n",
+		"deleted.yaml": "cluster: prod\nservice: {serviceName: deleted}\ntaskDefinition: {family: deleted}\n",
+		"staging.yaml": "cluster: staging\nservice: {serviceName: staging}\ntaskDefinition: {family: staging}\n",
+		"values.yaml":  "replicas: 2\n",
+		"notes.txt":    "cluster: prod\n",
+	}
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exported := map[string]bool{filepath.Join(directory, "api.yaml"): true}
+	if err := removeStaleFiles(directory, "prod", exported); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	sort.Strings(got)
+
+	want := []string{"api.yaml", "notes.txt", "staging.yaml", "values.yaml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining files = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,294 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+// serviceFilter is a parsed --filter expression. The expression is a list of
+// terms, separated by comma or spaces, which must all match. Each term compares
+// a service field with a value (or another field for numbers), e.g:
+//
+//	name=api-*,status=ACTIVE,launch=FARGATE
+//	running<desired
+//	family=web tag:team=payments
+//
+// String fields support the = and != operators, with glob patterns (*, ?, [a-z]).
+// Number fields support =, !=, <, <=, > and >=. A tag alone (e.g: tag:team)
+// matches the services which have that tag.
+type serviceFilter []*filterTerm
+
+// filterTerm is one comparison of the filter expression
+type filterTerm struct {
+	field string
+	op    string
+	value string
+}
+
+// stringFields are the service fields which can be compared to glob patterns
+var stringFields = map[string]func(service *ecs.Service) string{
+	"name": func(service *ecs.Service) string {
+		return aws.StringValue(service.ServiceName)
+	},
+	"status": func(service *ecs.Service) string {
+		return aws.StringValue(service.Status)
+	},
+	"launch": func(service *ecs.Service) string {
+		return launchType(service)
+	},
+	"scheduling": func(service *ecs.Service) string {
+		return aws.StringValue(service.SchedulingStrategy)
+	},
+	"family": func(service *ecs.Service) string {
+		family, _ := splitTaskDefinition(service.TaskDefinition)
+		return family
+	},
+	"taskdef": func(service *ecs.Service) string {
+		return taskDefinitionName(service.TaskDefinition)
+	},
+}
+
+// numberFields are the service fields which can be compared to numbers or to
+// each other (e.g: running<desired)
+var numberFields = map[string]func(service *ecs.Service) int64{
+	"running": func(service *ecs.Service) int64 {
+		return aws.Int64Value(service.RunningCount)
+	},
+	"desired": func(service *ecs.Service) int64 {
+		return aws.Int64Value(service.DesiredCount)
+	},
+	"pending": func(service *ecs.Service) int64 {
+		return aws.Int64Value(service.PendingCount)
+	},
+	"revision": func(service *ecs.Service) int64 {
+		_, revision := splitTaskDefinition(service.TaskDefinition)
+		return revision
+	},
+	"deployments": func(service *ecs.Service) int64 {
+		return int64(len(service.Deployments))
+	},
+}
+
+// field aliases, for convenience
+var fieldAliases = map[string]string{
+	"launchtype":     "launch",
+	"launch-type":    "launch",
+	"servicename":    "name",
+	"taskdefinition": "taskdef",
+}
+
+// a term is a field, an operator and a value. The operators are listed longest
+// first, so "<=" is not taken as "<".
+var termPattern = regexp.MustCompile(`^([A-Za-z:_./-][A-Za-z0-9:_./-]*?)(!=|==|<=|>=|=|<|>)(.*)$`)
+
+// parseFilter parses a --filter expression, see serviceFilter
+func parseFilter(expression string) (serviceFilter, error) {
+	var filter serviceFilter
+
+	terms := strings.FieldsFunc(expression, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+
+	for _, text := range terms {
+		term, err := parseTerm(text)
+		if err != nil {
+			return nil, err
+		}
+
+		filter = append(filter, term)
+	}
+
+	return filter, nil
+}
+
+func parseTerm(text string) (*filterTerm, error) {
+	// a tag alone, matches when the tag is set
+	if strings.HasPrefix(text, "tag:") && !strings.ContainsAny(text, "=<>!") {
+		return &filterTerm{field: text}, nil
+	}
+
+	match := termPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("Invalid filter '%s', expected <field><operator><value> (e.g: running<desired)", text)
+	}
+
+	term := &filterTerm{field: strings.ToLower(match[1]), op: match[2], value: match[3]}
+	if term.op == "==" {
+		term.op = "="
+	}
+
+	if alias, ok := fieldAliases[term.field]; ok {
+		term.field = alias
+	}
+
+	// tag keys are case sensitive
+	if strings.HasPrefix(term.field, "tag:") {
+		term.field = "tag:" + match[1][len("tag:"):]
+	}
+
+	if _, ok := numberFields[term.field]; ok {
+		if _, ok := numberFields[strings.ToLower(term.value)]; ok {
+			term.value = strings.ToLower(term.value)
+			return term, nil
+		}
+
+		if _, err := strconv.ParseInt(term.value, 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid filter '%s', '%s' is not a number nor a number field", text, term.value)
+		}
+
+		return term, nil
+	}
+
+	if _, ok := stringFields[term.field]; !ok && !strings.HasPrefix(term.field, "tag:") {
+		return nil, fmt.Errorf("Invalid filter '%s', unknown field '%s', use one of: %s", text, match[1], filterFields())
+	}
+
+	if term.op != "=" && term.op != "!=" {
+		return nil, fmt.Errorf("Invalid filter '%s', '%s' only supports the = and != operators", text, match[1])
+	}
+
+	if _, err := path.Match(term.value, ""); err != nil {
+		return nil, fmt.Errorf("Invalid filter '%s', bad pattern '%s'", text, term.value)
+	}
+
+	return term, nil
+}
+
+// Match returns whether the service matches all the filter terms
+func (f serviceFilter) Match(service *ecs.Service) bool {
+	for _, term := range f {
+		if !term.match(service) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t *filterTerm) match(service *ecs.Service) bool {
+	if strings.HasPrefix(t.field, "tag:") {
+		value, ok := serviceTag(service, t.field[len("tag:"):])
+		switch t.op {
+		case "":
+			return ok
+		case "=":
+			return ok && globMatch(t.value, value, false)
+		default:
+			return !ok || !globMatch(t.value, value, false)
+		}
+	}
+
+	if field, ok := numberFields[t.field]; ok {
+		left := field(service)
+
+		right, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			right = numberFields[t.value](service)
+		}
+
+		switch t.op {
+		case "=":
+			return left == right
+		case "!=":
+			return left != right
+		case "<":
+			return left < right
+		case "<=":
+			return left <= right
+		case ">":
+			return left > right
+		}
+		return left >= right
+	}
+
+	// status, launch type and so on are upper case on the API, but let's not
+	// make users type them in upper case.
+	matched := globMatch(t.value, stringFields[t.field](service), t.field != "name" && t.field != "family" && t.field != "taskdef")
+	if t.op == "!=" {
+		return !matched
+	}
+
+	return matched
+}
+
+func globMatch(pattern string, value string, ignoreCase bool) bool {
+	if ignoreCase {
+		pattern, value = strings.ToUpper(pattern), strings.ToUpper(value)
+	}
+
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+func serviceTag(service *ecs.Service, key string) (string, bool) {
+	for _, tag := range service.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value), true
+		}
+	}
+
+	return "", false
+}
+
+// launchType returns the service launch type, or the capacity provider for the
+// services using a capacity provider strategy instead.
+func launchType(service *ecs.Service) string {
+	if service.LaunchType != nil {
+		return aws.StringValue(service.LaunchType)
+	}
+
+	for _, strategy := range service.CapacityProviderStrategy {
+		return aws.StringValue(strategy.CapacityProvider)
+	}
+
+	return ""
+}
+
+// splitTaskDefinition returns the family and revision out of a task definition ARN
+func splitTaskDefinition(arn *string) (string, int64) {
+	name := taskDefinitionName(arn)
+
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return name, 0
+	}
+
+	revision, _ := strconv.ParseInt(name[i+1:], 10, 64)
+	return name[:i], revision
+}
+
+func filterFields() string {
+	var fields []string
+	for field := range stringFields {
+		fields = append(fields, field)
+	}
+	for field := range numberFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return strings.Join(append(fields, "tag:<key>"), ", ")
+}
@@ -0,0 +1,126 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       serviceFilter
+		wantErr    bool
+	}{
+		{expression: "", want: nil},
+		{
+			expression: "name=api-*,status=ACTIVE",
+			want:       serviceFilter{{field: "name", op: "=", value: "api-*"}, {field: "status", op: "=", value: "ACTIVE"}},
+		},
+		{
+			expression: "running<desired pending>=1",
+			want:       serviceFilter{{field: "running", op: "<", value: "desired"}, {field: "pending", op: ">=", value: "1"}},
+		},
+		{
+			expression: "LaunchType==fargate",
+			want:       serviceFilter{{field: "launch", op: "=", value: "fargate"}},
+		},
+		{
+			expression: "tag:Team=payments,tag:Owner",
+			want:       serviceFilter{{field: "tag:Team", op: "=", value: "payments"}, {field: "tag:Owner"}},
+		},
+		{expression: "running<Desired", want: serviceFilter{{field: "running", op: "<", value: "desired"}}},
+		{expression: "running<lots", wantErr: true},
+		{expression: "colour=blue", wantErr: true},
+		{expression: "name<api", wantErr: true},
+		{expression: "name=[a-", wantErr: true},
+		{expression: "api", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			got, err := parseFilter(test.expression)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseFilter() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	service := &ecs.Service{
+		ServiceName:    aws.String("api-web"),
+		Status:         aws.String("ACTIVE"),
+		LaunchType:     aws.String("FARGATE"),
+		TaskDefinition: aws.String("arn:aws:ecs:us-east-1:123456789012:task-definition/api:12"),
+		RunningCount:   aws.Int64(2),
+		DesiredCount:   aws.Int64(3),
+		Tags:           []*ecs.Tag{{Key: aws.String("team"), Value: aws.String("payments")}},
+	}
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{"", true},
+		{"name=api-*", true},
+		{"name=API-*", false},
+		{"name!=api-*", false},
+		{"status=active", true},
+		{"launch=EC2", false},
+		{"family=api,revision>=12", true},
+		{"taskdef=api:1?", true},
+		{"revision<12", false},
+		{"running<desired", true},
+		{"running=desired", false},
+		{"desired=3,running=2", true},
+		{"tag:team", true},
+		{"tag:owner", false},
+		{"tag:team=pay*", true},
+		{"tag:team!=payments", false},
+		{"tag:owner!=x", true},
+		{"name=api-*,launch=EC2", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			filter, err := parseFilter(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := filter.Match(service); got != test.want {
+				t.Errorf("Match() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
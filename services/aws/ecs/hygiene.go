@@ -0,0 +1,330 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// the severities of the findings, from the most to the least severe
+var severities = []string{"HIGH", "MEDIUM", "LOW"}
+
+// secretNames matches the environment variable names which usually hold secrets
+var secretNames = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY|CREDENTIAL)`)
+
+// values at least this long, and this random (bits per character), look like
+// generated secrets rather than configuration.
+const (
+	secretMinLength  = 20
+	secretMinEntropy = 4.0
+)
+
+// hygieneOptions defines the options used on the `aws-ecs audit` command
+type hygieneOptions struct {
+
+	// fail when there's a finding of this severity or higher
+	failOn string `type:"string" required:"false"`
+
+	// how to print the findings
+	output output.Options `type:"output.Options" required:"false"`
+
+	// which services to audit the task definitions of, as on `aws-ecs list`
+	list listOptions `type:"listOptions" required:"true"`
+}
+
+// finding is one issue found on a task definition
+type finding struct {
+	Severity       string
+	TaskDefinition string
+	Container      string `json:",omitempty"`
+	Rule           string
+	Detail         string
+	Services       []string
+}
+
+// findingColumns defines the table columns of the `aws-ecs audit` command
+var findingColumns = []output.Column{
+	{Header: "Severity", Value: func(obj interface{}) string {
+		return obj.(*finding).Severity
+	}},
+	{Header: "Task Definition", Value: func(obj interface{}) string {
+		return obj.(*finding).TaskDefinition
+	}},
+	{Header: "Container", Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*finding).Container)
+	}},
+	{Header: "Rule", Value: func(obj interface{}) string {
+		return obj.(*finding).Rule
+	}},
+	{Header: "Detail", Value: func(obj interface{}) string {
+		return obj.(*finding).Detail
+	}},
+	{Header: "Services", Wide: true, Value: func(obj interface{}) string {
+		return output.Join(obj.(*finding).Services)
+	}},
+}
+
+// auditTaskDefinitions checks the task definitions used by the services for
+// secrets in plain text and risky settings.
+func auditTaskDefinitions(options *hygieneOptions) error {
+	printer, err := output.NewPrinter(os.Stdout, &options.output, findingColumns)
+	if err != nil {
+		return err
+	}
+
+	locations, err := clusterLocations(&options.list)
+	if err != nil {
+		return err
+	}
+
+	results := make([][]*serviceItem, len(locations))
+	err = forEachLocation(locations, func(i int, location *clusterLocation) error {
+		var err error
+		results[i], err = listClusterServices(&options.list, location)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// the services using each task definition, indexed by ARN
+	services := make(map[string][]string)
+	for _, items := range results {
+		for _, item := range items {
+			arn := aws.StringValue(item.TaskDefinition)
+			services[arn] = append(services[arn], resourceID(item.ClusterArn)+"/"+aws.StringValue(item.ServiceName))
+		}
+	}
+
+	client, err := ecsClient(&options.list.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	var findings []*finding
+	for arn, names := range services {
+		taskDefinition, _, err := describeTaskDefinition(client, arn)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range checkTaskDefinition(taskDefinition) {
+			f.Services = names
+			findings = append(findings, f)
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Severity != b.Severity {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.TaskDefinition != b.TaskDefinition {
+			return a.TaskDefinition < b.TaskDefinition
+		}
+		if a.Container != b.Container {
+			return a.Container < b.Container
+		}
+		return a.Rule < b.Rule
+	})
+
+	failed := 0
+	for _, f := range findings {
+		if options.failOn != "" && severityRank(f.Severity) <= severityRank(options.failOn) {
+			failed++
+		}
+
+		if err := printer.Print(f); err != nil {
+			return err
+		}
+	}
+
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d findings on %d task definitions\n", len(findings), len(services))
+	if failed > 0 {
+		return fmt.Errorf("%d findings of severity %s or higher", failed, options.failOn)
+	}
+
+	return nil
+}
+
+// checkTaskDefinition returns the findings of every container of the task definition
+func checkTaskDefinition(taskDefinition *ecs.TaskDefinition) []*finding {
+	var findings []*finding
+	name := taskDefinitionName(taskDefinition.TaskDefinitionArn)
+
+	add := func(severity string, container *ecs.ContainerDefinition, rule string, detail string) {
+		findings = append(findings, &finding{
+			Severity:       severity,
+			TaskDefinition: name,
+			Container:      aws.StringValue(container.Name),
+			Rule:           rule,
+			Detail:         detail,
+		})
+	}
+
+	for _, container := range taskDefinition.ContainerDefinitions {
+		// the values are never printed, they may be actual secrets
+		for _, variable := range container.Environment {
+			key, value := aws.StringValue(variable.Name), aws.StringValue(variable.Value)
+			switch {
+			case value == "":
+			case secretNames.MatchString(key):
+				add("HIGH", container, "plaintext-secret", fmt.Sprintf("%s looks like a secret, use secrets instead of environment", key))
+			case looksRandom(value):
+				add("MEDIUM", container, "plaintext-secret", fmt.Sprintf("%s has a high entropy value, use secrets if it's a credential", key))
+			}
+		}
+
+		if aws.BoolValue(container.Privileged) {
+			add("HIGH", container, "privileged", "container runs privileged, with full access to the host")
+		}
+
+		image := aws.StringValue(container.Image)
+		if tag, ok := imageTag(image); !ok {
+			add("MEDIUM", container, "mutable-tag", fmt.Sprintf("image %s has no tag, which means latest", image))
+		} else if tag == "latest" {
+			add("MEDIUM", container, "mutable-tag", fmt.Sprintf("image %s uses the latest tag", image))
+		}
+
+		if container.LogConfiguration == nil {
+			add("MEDIUM", container, "no-logging", "no log configuration, the container logs are lost")
+		}
+
+		if container.Memory == nil && taskDefinition.Memory == nil {
+			add("MEDIUM", container, "no-memory-limit", "neither the container nor the task have a hard memory limit")
+		}
+
+		switch user := aws.StringValue(container.User); {
+		case user == "":
+			add("LOW", container, "root-user", "no user set, the image default user is used (usually root)")
+		case user == "root" || user == "0" || strings.HasPrefix(user, "0:") || strings.HasPrefix(user, "root:"):
+			add("MEDIUM", container, "root-user", "container runs as root")
+		}
+	}
+
+	return findings
+}
+
+// imageTag returns the tag of the image, false when it has neither a tag nor a
+// digest. Images pinned by digest are returned with an empty tag.
+func imageTag(image string) (string, bool) {
+	if strings.Contains(image, "@") {
+		return "", true
+	}
+
+	// the registry may have a port, e.g: registry:5000/app
+	name := image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return "", false
+	}
+
+	return name[i+1:], true
+}
+
+// looksRandom returns whether the value looks like a generated secret
+func looksRandom(value string) bool {
+	if len(value) < secretMinLength || strings.ContainsAny(value, " /") {
+		return false
+	}
+
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+	}
+
+	var entropy float64
+	length := float64(len([]rune(value)))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy >= secretMinEntropy
+}
+
+// severityRank returns the position of the severity, the most severe first
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+
+	return len(severities)
+}
+
+// AuditCommand returns the `aws-ecs audit` command, which reports secrets in plain
+// text and risky settings on the task definitions used by the services.
+func AuditCommand() *cobra.Command {
+	var options hygieneOptions
+
+	cmd := &cobra.Command{
+		Use:   "audit [cluster]",
+		Short: "Report plain text secrets and risky settings on the task definitions in use",
+		Long: "Report plain text secrets and risky settings on the task definitions used by the services:\n" +
+			"secret looking environment variables, latest or missing image tags, missing log configuration,\n" +
+			"privileged containers, missing memory limits and containers running as root.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateArgs(&options.list, args); err != nil {
+				return err
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			options.failOn = strings.ToUpper(options.failOn)
+			if options.failOn != "" && severityRank(options.failOn) == len(severities) {
+				return errors.New("Invalid --fail-on severity, use one of: " + strings.Join(severities, ", "))
+			}
+
+			if len(args) == 1 {
+				options.list.clusterName = args[0]
+			}
+			return auditTaskDefinitions(&options)
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	options.list.awsOptions.AddFlags(flags)
+	flags.StringVarP(&options.list.filter, "filter", "f", "", "Audit the services matching the filter, see 'aws-ecs list --help'")
+	flags.BoolVarP(&options.list.allClusters, "all-clusters", "A", false, "Audit the services of every cluster")
+	flags.StringVarP(&options.failOn, "fail-on", "", "", "Exit non-zero when there's a finding of this severity or higher: HIGH, MEDIUM or LOW")
+	options.output.AddFlags(flags)
+	return cmd
+}
@@ -0,0 +1,359 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+	ecrLibrary "github.com/raffs/sysadmin-sk/services/aws/ecr"
+)
+
+// the status of the images, as compared with ECR
+const (
+	imageOK       = "OK"
+	imageMissing  = "MISSING"
+	imageTagMoved = "TAG MOVED"
+	imageNotECR   = "NOT ECR"
+)
+
+// the ECR scan severities, most severe first
+var scanSeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFORMATIONAL", "UNDEFINED"}
+
+// imagesOptions defines the options used on the `aws-ecs images` command
+type imagesOptions struct {
+
+	// cluster to check the images of
+	clusterName string `type:"string" required:"true"`
+
+	// select the services to check, see the `aws-ecs list` filter
+	filter string `type:"string" required:"false"`
+
+	// the parsed filter expression
+	serviceFilter serviceFilter `type:"serviceFilter" required:"false"`
+
+	// how to print the images
+	output output.Options `type:"output.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// imageUsage is an image used by the cluster, along with its status on ECR
+type imageUsage struct {
+	Image           string
+	Status          string
+	Detail          string `json:",omitempty"`
+	RunningTasks    int
+	RunningDigests  []string                `json:",omitempty"`
+	TaskDefinitions []string                `json:",omitempty"`
+	ECR             *ecrLibrary.ImageStatus `json:",omitempty"`
+}
+
+// imageColumns defines the table columns of the `aws-ecs images` command
+var imageColumns = []output.Column{
+	{Header: "Image", Value: func(obj interface{}) string {
+		return obj.(*imageUsage).Image
+	}},
+	{Header: "Status", Value: func(obj interface{}) string {
+		return obj.(*imageUsage).Status
+	}},
+	{Header: "Pushed", Value: func(obj interface{}) string {
+		if image := obj.(*imageUsage); image.ECR != nil {
+			return output.Age(image.ECR.PushedAt)
+		}
+		return "<none>"
+	}},
+	{Header: "Running", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*imageUsage).RunningTasks)
+	}},
+	{Header: "Findings", Value: func(obj interface{}) string {
+		if image := obj.(*imageUsage); image.ECR != nil {
+			return scanFindings(image.ECR.Findings)
+		}
+		return "<none>"
+	}},
+	{Header: "Digest", Wide: true, Value: func(obj interface{}) string {
+		if image := obj.(*imageUsage); image.ECR != nil {
+			return valueOrNone(shortDigest(image.ECR.Digest))
+		}
+		return "<none>"
+	}},
+	{Header: "Running Digests", Wide: true, Value: func(obj interface{}) string {
+		var digests []string
+		for _, digest := range obj.(*imageUsage).RunningDigests {
+			digests = append(digests, shortDigest(digest))
+		}
+		return output.Join(digests)
+	}},
+	{Header: "Task Definitions", Wide: true, Value: func(obj interface{}) string {
+		return output.Join(obj.(*imageUsage).TaskDefinitions)
+	}},
+	{Header: "Detail", Wide: true, Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*imageUsage).Detail)
+	}},
+}
+
+// checkImages compares the images used by the services and running tasks of the
+// cluster with what's on ECR.
+func checkImages(options *imagesOptions) error {
+	printer, err := output.NewPrinter(os.Stdout, &options.output, imageColumns)
+	if err != nil {
+		return err
+	}
+
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	usages := make(map[string]*imageUsage)
+	usage := func(image string) *imageUsage {
+		if _, ok := usages[image]; !ok {
+			usages[image] = &imageUsage{Image: image}
+		}
+		return usages[image]
+	}
+
+	listOptions := &listOptions{serviceFilter: options.serviceFilter, awsOptions: options.awsOptions}
+	items, err := listClusterServices(listOptions, &clusterLocation{cluster: options.clusterName})
+	if err != nil {
+		return err
+	}
+
+	if err := collectTaskDefinitionImages(client, items, usage); err != nil {
+		return err
+	}
+
+	// without a filter, the standalone tasks are checked too
+	var groups map[string]bool
+	if len(options.serviceFilter) > 0 {
+		groups = make(map[string]bool)
+		for _, item := range items {
+			groups["service:"+aws.StringValue(item.ServiceName)] = true
+		}
+	}
+
+	if err := collectRunningImages(client, options.clusterName, groups, usage); err != nil {
+		return err
+	}
+
+	var images []*imageUsage
+	for _, image := range usages {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Image < images[j].Image
+	})
+
+	err = forEach(len(images), func(i int) error {
+		return compareWithECR(&options.awsOptions, images[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		if err := printer.Print(image); err != nil {
+			return err
+		}
+	}
+
+	return printer.Flush()
+}
+
+// collectTaskDefinitionImages adds the images of the task definitions used by the services
+func collectTaskDefinitionImages(client *ecs.ECS, items []*serviceItem, usage func(string) *imageUsage) error {
+	seen := make(map[string]bool)
+	for _, item := range items {
+		arn := aws.StringValue(item.TaskDefinition)
+		if seen[arn] {
+			continue
+		}
+		seen[arn] = true
+
+		taskDefinition, _, err := describeTaskDefinition(client, arn)
+		if err != nil {
+			return err
+		}
+
+		for _, container := range taskDefinition.ContainerDefinitions {
+			image := usage(aws.StringValue(container.Image))
+			image.TaskDefinitions = appendUnique(image.TaskDefinitions, taskDefinitionName(taskDefinition.TaskDefinitionArn))
+		}
+	}
+
+	return nil
+}
+
+// collectRunningImages adds the images, and their digest, of the running tasks.
+// When groups is not nil, only the tasks of these groups (e.g: service:api) are
+// counted.
+func collectRunningImages(client *ecs.ECS, cluster string, groups map[string]bool, usage func(string) *imageUsage) error {
+	var taskArns []*string
+
+	listTasksInput := &ecs.ListTasksInput{Cluster: aws.String(cluster)}
+	err := client.ListTasksPages(listTasksInput, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		taskArns = append(taskArns, page.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	tasks, err := describeTasks(client, cluster, taskArns)
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if groups != nil && !groups[aws.StringValue(task.Group)] {
+			continue
+		}
+
+		for _, container := range task.Containers {
+			image := usage(aws.StringValue(container.Image))
+			image.RunningTasks++
+			if container.ImageDigest != nil {
+				image.RunningDigests = appendUnique(image.RunningDigests, aws.StringValue(container.ImageDigest))
+			}
+		}
+	}
+
+	return nil
+}
+
+// compareWithECR sets the status of the image: whether it still exists and, for
+// images referenced by tag, whether the tag still points to what is running.
+func compareWithECR(options *awssession.Options, image *imageUsage) error {
+	reference, ok := ecrLibrary.ParseImage(image.Image)
+	if !ok {
+		image.Status = imageNotECR
+		return nil
+	}
+
+	status, err := ecrLibrary.DescribeImage(options, reference)
+	if err != nil {
+		return err
+	}
+
+	image.ECR = status
+	image.Status = imageOK
+
+	switch {
+	case !status.Exists:
+		image.Status = imageMissing
+		image.Detail = "the image was deleted, new tasks will fail to pull it"
+
+	case reference.Digest == "" && len(image.RunningDigests) > 0 && !containsString(image.RunningDigests, status.Digest):
+		image.Status = imageTagMoved
+		image.Detail = fmt.Sprintf("tag %s now points to %s, new tasks will run a different image",
+			reference.Tag, shortDigest(status.Digest))
+	}
+
+	return nil
+}
+
+// scanFindings formats the number of findings per severity, e.g: CRITICAL:1 HIGH:3
+func scanFindings(findings map[string]int64) string {
+	var counts []string
+	for _, severity := range scanSeverities {
+		if count := findings[severity]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%s:%d", severity, count))
+		}
+	}
+
+	if len(counts) == 0 {
+		return "<none>"
+	}
+
+	return strings.Join(counts, " ")
+}
+
+// shortDigest returns the first 12 characters of the digest, as docker shows them
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+
+	return digest
+}
+
+func appendUnique(values []string, value string) []string {
+	if containsString(values, value) {
+		return values
+	}
+
+	return append(values, value)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ImagesCommand returns the `aws-ecs images` command, which checks the images used
+// by the cluster against ECR.
+func ImagesCommand() *cobra.Command {
+	var options imagesOptions
+
+	cmd := &cobra.Command{
+		Use:   "images <cluster>",
+		Short: "Check the images used by the services and tasks of a cluster against ECR",
+		Long: "Check the images used by the services and tasks of a cluster against ECR: whether they still\n" +
+			"exist, when they were pushed, whether their tag moved to another digest than the one running,\n" +
+			"and their scan findings.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("Invalid number of arguments for aws-ecs images command. Use --help for details")
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			serviceFilter, err := parseFilter(options.filter)
+			if err != nil {
+				return err
+			}
+
+			options.serviceFilter = serviceFilter
+			options.clusterName = args[0]
+			return checkImages(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "", "Check the services, and their running tasks, matching the filter, see 'aws-ecs list --help'")
+	options.output.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
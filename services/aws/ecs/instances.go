@@ -0,0 +1,294 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// taskInstance is a task of a service, along with where it's running. The
+// containers of the task come with it, as returned by DescribeTasks.
+type taskInstance struct {
+	*ecs.Task
+
+	// The EC2 instance running the task, empty on Fargate
+	Ec2InstanceId string `json:",omitempty"`
+
+	// The private IP of the task network interface (awsvpc) or of the EC2 instance
+	PrivateIpAddress string `json:",omitempty"`
+
+	// The network interface of the task, only for the awsvpc network mode
+	NetworkInterfaceId string `json:",omitempty"`
+}
+
+// taskContainer is one container of a task, printed as a row of the nested table
+type taskContainer struct {
+	*taskInstance
+
+	// The container, nil when the task reports none (e.g: still provisioning)
+	Container *ecs.Container
+}
+
+// taskColumns defines the columns of the task containers, nested under each service
+var taskColumns = []output.Column{
+	{Header: "Task", Value: func(obj interface{}) string {
+		return resourceID(obj.(*taskContainer).TaskArn)
+	}},
+	{Header: "Container", Value: func(obj interface{}) string {
+		if container := obj.(*taskContainer).Container; container != nil {
+			return aws.StringValue(container.Name)
+		}
+		return "<none>"
+	}},
+	{Header: "Image", Value: func(obj interface{}) string {
+		if container := obj.(*taskContainer).Container; container != nil {
+			return aws.StringValue(container.Image)
+		}
+		return "<none>"
+	}},
+	{Header: "Status", Value: func(obj interface{}) string {
+		task := obj.(*taskContainer)
+		if task.Container != nil {
+			return aws.StringValue(task.Container.LastStatus)
+		}
+		return aws.StringValue(task.LastStatus)
+	}},
+	{Header: "Health", Value: func(obj interface{}) string {
+		task := obj.(*taskContainer)
+		if task.Container != nil {
+			return aws.StringValue(task.Container.HealthStatus)
+		}
+		return aws.StringValue(task.HealthStatus)
+	}},
+	{Header: "Revision", Value: func(obj interface{}) string {
+		_, revision := splitTaskDefinition(obj.(*taskContainer).TaskDefinitionArn)
+		return fmt.Sprint(revision)
+	}},
+	{Header: "AZ", Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*taskContainer).AvailabilityZone)
+	}},
+	{Header: "IP", Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*taskContainer).PrivateIpAddress)
+	}},
+	{Header: "ENI", Wide: true, Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*taskContainer).NetworkInterfaceId)
+	}},
+	{Header: "Digest", Wide: true, Value: func(obj interface{}) string {
+		if container := obj.(*taskContainer).Container; container != nil {
+			return valueOrNone(aws.StringValue(container.ImageDigest))
+		}
+		return "<none>"
+	}},
+	{Header: "Instance", Value: func(obj interface{}) string {
+		task := obj.(*taskContainer)
+		if task.Ec2InstanceId == "" {
+			return aws.StringValue(task.LaunchType)
+		}
+		return task.Ec2InstanceId
+	}},
+	{Header: "Uptime", Value: func(obj interface{}) string {
+		return output.Age(obj.(*taskContainer).StartedAt)
+	}},
+}
+
+// Children returns the containers of the service tasks, printed nested under the service
+func (s *serviceItem) Children() ([]output.Column, []interface{}) {
+	var children []interface{}
+	for _, task := range s.Tasks {
+		if len(task.Containers) == 0 {
+			children = append(children, &taskContainer{taskInstance: task})
+			continue
+		}
+
+		for _, container := range task.Containers {
+			children = append(children, &taskContainer{taskInstance: task, Container: container})
+		}
+	}
+
+	return taskColumns, children
+}
+
+// describeServiceTasks returns the running tasks of the service along with the
+// EC2 instance (for the EC2 launch type) and network interface they are using.
+func describeServiceTasks(client *ecs.ECS, instancesClient *ec2.EC2, service *ecs.Service) ([]*taskInstance, error) {
+	var taskArns []*string
+
+	listTasksInput := &ecs.ListTasksInput{
+		Cluster:     service.ClusterArn,
+		ServiceName: service.ServiceName,
+	}
+
+	err := client.ListTasksPages(listTasksInput, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		taskArns = append(taskArns, page.TaskArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	described, err := describeTasks(client, aws.StringValue(service.ClusterArn), taskArns)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []*taskInstance
+	containerInstances := make(map[string]string)
+
+	for _, task := range described {
+		instance := &taskInstance{Task: task}
+		instance.NetworkInterfaceId, instance.PrivateIpAddress = taskNetworkInterface(task)
+
+		if task.ContainerInstanceArn != nil {
+			containerInstances[*task.ContainerInstanceArn] = ""
+		}
+
+		tasks = append(tasks, instance)
+	}
+
+	if len(containerInstances) == 0 {
+		return tasks, nil
+	}
+
+	if err := describeContainerInstances(client, service.ClusterArn, containerInstances); err != nil {
+		return nil, err
+	}
+
+	privateIPs, err := instancesPrivateIP(instancesClient, containerInstances)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		if task.ContainerInstanceArn == nil {
+			continue
+		}
+
+		task.Ec2InstanceId = containerInstances[*task.ContainerInstanceArn]
+		if task.PrivateIpAddress == "" {
+			task.PrivateIpAddress = privateIPs[task.Ec2InstanceId]
+		}
+	}
+
+	return tasks, nil
+}
+
+// describeContainerInstances fills in the EC2 instance ID of the given container
+// instances, indexed by their ARN.
+func describeContainerInstances(client *ecs.ECS, cluster *string, instances map[string]string) error {
+	var arns []*string
+	for arn := range instances {
+		arns = append(arns, aws.String(arn))
+	}
+
+	// DescribeContainerInstances accepts up to 100 instances at a time
+	for i := 0; i < len(arns); i += 100 {
+		upperBound := i + 100
+		if upperBound > len(arns) {
+			upperBound = len(arns)
+		}
+
+		description, err := client.DescribeContainerInstances(&ecs.DescribeContainerInstancesInput{
+			Cluster:            cluster,
+			ContainerInstances: arns[i:upperBound],
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range description.ContainerInstances {
+			instances[aws.StringValue(instance.ContainerInstanceArn)] = aws.StringValue(instance.Ec2InstanceId)
+		}
+	}
+
+	return nil
+}
+
+// instancesPrivateIP returns the private IP of the EC2 instances, indexed by ID
+func instancesPrivateIP(client *ec2.EC2, containerInstances map[string]string) (map[string]string, error) {
+	var instanceIds []*string
+	for _, instanceID := range containerInstances {
+		if instanceID != "" {
+			instanceIds = append(instanceIds, aws.String(instanceID))
+		}
+	}
+
+	privateIPs := make(map[string]string)
+	if len(instanceIds) == 0 {
+		return privateIPs, nil
+	}
+
+	err := client.DescribeInstancesPages(&ec2.DescribeInstancesInput{InstanceIds: instanceIds},
+		func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					privateIPs[aws.StringValue(instance.InstanceId)] = aws.StringValue(instance.PrivateIpAddress)
+				}
+			}
+			return true
+		})
+
+	return privateIPs, err
+}
+
+// taskNetworkInterface returns the ID and private IP of the task network
+// interface, only set for tasks using the awsvpc network mode.
+func taskNetworkInterface(task *ecs.Task) (string, string) {
+	for _, attachment := range task.Attachments {
+		if aws.StringValue(attachment.Type) != "ElasticNetworkInterface" {
+			continue
+		}
+
+		var eni, ip string
+		for _, detail := range attachment.Details {
+			switch aws.StringValue(detail.Name) {
+			case "networkInterfaceId":
+				eni = aws.StringValue(detail.Value)
+			case "privateIPv4Address":
+				ip = aws.StringValue(detail.Value)
+			}
+		}
+
+		return eni, ip
+	}
+
+	return "", ""
+}
+
+// resourceID returns the last part of an ARN, e.g: the task ID
+func resourceID(arn *string) string {
+	id := aws.StringValue(arn)
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+
+	return id
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+
+	return value
+}
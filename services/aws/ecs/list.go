@@ -19,15 +19,18 @@ package ecs
 import (
 	"errors"
 	"fmt"
-	"html/template"
 	"os"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/ecs"
 	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
 )
 
 // ListOptions defines the options used on the `aws ecs list` command
@@ -36,127 +39,269 @@ type listOptions struct {
 	// cluster name to list services information
 	clusterName string `type:"string" required:"true"`
 
-	// filter out specific services or label information
-	filter string `type:"string" required:"false"`
+	// list the services of every cluster, instead of the given one
+	allClusters bool `type:"bool" required:"false"`
 
-	// the format to output the string
-	format string `type:"string" required:"false"`
+	// regions to list the services from, instead of the configured region
+	regions []string `type:"[]string" required:"false"`
+
+	// list the services from every enabled region
+	allRegions bool `type:"bool" required:"false"`
 
 	// filter out specific services or label information
-	listTaskInstances bool `type:"string" required:"false"`
+	filter string `type:"string" required:"false"`
 
-	// Define which AWS region to connect to the service
-	awsRegion string `type:"string" required:"false"`
+	// the parsed filter expression
+	serviceFilter serviceFilter `type:"serviceFilter" required:"false"`
 
-	// Define the AWS API endpoint. Usually this is use for lower-level API call
-	// and for testing and/or mocking.
-	awsEndpoint string `type:"string" required:"false"`
+	// how to print the services
+	output output.Options `type:"output.Options" required:"false"`
 
-	// Define the AWS profile
-	awsProfile string `type:"string" required:"false"`
+	// list the tasks of each service, and where they are running
+	listTaskInstances bool `type:"bool" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
 }
 
 // ecsClient Return a AWS ECS client with an open session.
-func ecsClient(options *listOptions) (*ecs.ECS, error) {
-	sessionOpts := session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-		// aws configuration
-		Config: aws.Config{
-			Region:   aws.String(options.awsRegion),
-			Endpoint: aws.String(options.awsEndpoint),
-		},
+func ecsClient(options *awssession.Options) (*ecs.ECS, error) {
+	session, err := awssession.New(options)
+	if err != nil {
+		return nil, err
 	}
 
-	session, err := session.NewSessionWithOptions(sessionOpts)
+	return ecs.New(session, request.WithRetryer(aws.NewConfig(), client.DefaultRetryer{
+		NumMaxRetries:    maxRetries,
+		MinThrottleDelay: minThrottleDelay,
+		MaxThrottleDelay: maxThrottleDelay,
+	})), nil
+}
+
+// ec2Client Return a AWS EC2 client with an open session, used to look up the
+// container instances.
+func ec2Client(options *awssession.Options) (*ec2.EC2, error) {
+	session, err := awssession.New(options)
 	if err != nil {
-		fmt.Println("Unable to create new session with AWS with error: ", err.Error())
-		return nil, errors.New("Unable to initialize AWS session")
+		return nil, err
 	}
 
-	return ecs.New(session), nil
+	return ec2.New(session), nil
+}
+
+// serviceItem is one service printed by the `aws-ecs list` command
+type serviceItem struct {
+	*ecs.Service
+
+	// Where the service is deployed, for listing multiple clusters or regions
+	Region      string `json:",omitempty"`
+	ClusterName string `json:",omitempty"`
+
+	// The tasks of the service, only filled in with --list-instance
+	Tasks []*taskInstance `json:",omitempty"`
+}
+
+// locationColumns are shown, before the service columns, when listing the
+// services of multiple clusters or regions.
+var locationColumns = []output.Column{
+	{Header: "Region", Value: func(obj interface{}) string {
+		return obj.(*serviceItem).Region
+	}},
+	{Header: "Cluster", Value: func(obj interface{}) string {
+		return obj.(*serviceItem).ClusterName
+	}},
+}
+
+// serviceColumns defines the table columns of the `aws-ecs list` command
+var serviceColumns = []output.Column{
+	{Header: "Name", Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*serviceItem).ServiceName)
+	}},
+	{Header: "Status", Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*serviceItem).Status)
+	}},
+	{Header: "Running", Value: func(obj interface{}) string {
+		service := obj.(*serviceItem)
+		return fmt.Sprintf("%d/%d", aws.Int64Value(service.RunningCount), aws.Int64Value(service.DesiredCount))
+	}},
+	{Header: "Scheduling", Value: func(obj interface{}) string {
+		return aws.StringValue(obj.(*serviceItem).SchedulingStrategy)
+	}},
+	{Header: "Pending", Wide: true, Value: func(obj interface{}) string {
+		return fmt.Sprint(aws.Int64Value(obj.(*serviceItem).PendingCount))
+	}},
+	{Header: "Launch Type", Wide: true, Value: func(obj interface{}) string {
+		return launchType(obj.(*serviceItem).Service)
+	}},
+	{Header: "Task Definition", Wide: true, Value: func(obj interface{}) string {
+		return taskDefinitionName(obj.(*serviceItem).TaskDefinition)
+	}},
+	{Header: "Age", Wide: true, Value: func(obj interface{}) string {
+		return output.Age(obj.(*serviceItem).CreatedAt)
+	}},
+}
+
+// taskDefinitionName returns the family:revision out of a task definition ARN
+func taskDefinitionName(arn *string) string {
+	name := aws.StringValue(arn)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return name
 }
 
 // listServices
 func listServices(options *listOptions) error {
-	tabw := new(tabwriter.Writer)
-	tabw.Init(os.Stdout, 20, 1, 3, ' ', 0)
-	defer tabw.Flush()
+	columns := serviceColumns
+	if options.allClusters || options.allRegions || len(options.regions) > 1 {
+		columns = append(locationColumns[:len(locationColumns):len(locationColumns)], serviceColumns...)
+	}
 
-	template, err := template.New("").Parse(options.format)
+	printer, err := output.NewPrinter(os.Stdout, &options.output, columns)
 	if err != nil {
-		fmt.Println("Not able to parse template: ", options.format)
-		return errors.New("Failed to parse the above template")
+		return err
 	}
 
-	columns := strings.Replace(options.format, "{{", "", -1)
-	columns = strings.Replace(columns, "}}", "", -1)
-	columns = strings.Replace(columns, ".", "", -1)
-	columns = strings.Replace(columns, "\n", "", -1)
-	fmt.Fprintf(tabw, "%v", columns)
-
-	client, err := ecsClient(options)
+	locations, err := clusterLocations(options)
 	if err != nil {
 		return err
 	}
 
+	// list every cluster concurrently, but print them in order
+	results := make([][]*serviceItem, len(locations))
+	errs := forEachLocation(locations, func(i int, location *clusterLocation) error {
+		var err error
+		results[i], err = listClusterServices(options, location)
+		return err
+	})
+
+	for _, items := range results {
+		for _, item := range items {
+			if err := printer.Print(item); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+
+	return errs
+}
+
+// listClusterServices returns the services of one cluster which match the filter
+func listClusterServices(options *listOptions, location *clusterLocation) ([]*serviceItem, error) {
+	awsOptions := options.awsOptions.InRegion(location.region)
+
+	client, err := ecsClient(awsOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var instancesClient *ec2.EC2
+	if options.listTaskInstances {
+		instancesClient, err = ec2Client(awsOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var serviceArns []*string
 	listServicesInput := &ecs.ListServicesInput{
-		Cluster:    aws.String(options.clusterName),
+		Cluster:    aws.String(location.cluster),
 		MaxResults: aws.Int64(100),
 	}
 
-	// loop until there's no more page
-	for serviceList, err := client.ListServices(listServicesInput); ; {
+	err = client.ListServicesPages(listServicesInput, func(page *ecs.ListServicesOutput, lastPage bool) bool {
+		serviceArns = append(serviceArns, page.ServiceArns...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// DescribeServices accepts up to 10 services at a time, the chunks are described
+	// concurrently and their results kept apart so the order does not change.
+	chunks := (len(serviceArns) + 9) / 10
+	results := make([][]*serviceItem, chunks)
+
+	err = forEachLimit(chunks, maxConcurrentDescribes, func(i int) error {
+		upperBound := (i + 1) * 10
+		if upperBound > len(serviceArns) {
+			upperBound = len(serviceArns)
+		}
+
+		describeInput := &ecs.DescribeServicesInput{
+			Cluster:  aws.String(location.cluster),
+			Services: serviceArns[i*10 : upperBound],
+			Include:  []*string{aws.String(ecs.ServiceFieldTags)},
+		}
+
+		servicesDescription, err := client.DescribeServices(describeInput)
 		if err != nil {
 			return err
 		}
 
-		lenServices := len(serviceList.ServiceArns)
-		for i := 0; i < lenServices; i += 10 {
-			upperBound := i + 10
-			if upperBound >= lenServices {
-				upperBound = i + (lenServices - i)
-			}
-
-			describeInput := &ecs.DescribeServicesInput{
-				Cluster:  aws.String(options.clusterName),
-				Services: serviceList.ServiceArns[i:upperBound],
+		for _, service := range servicesDescription.Services {
+			if !options.serviceFilter.Match(service) {
+				continue
 			}
 
-			servicesDescription, err := client.DescribeServices(describeInput)
-			if err != nil {
-				return err
+			item := &serviceItem{
+				Service:     service,
+				Region:      location.region,
+				ClusterName: resourceID(service.ClusterArn),
 			}
 
-			for _, service := range servicesDescription.Services {
-				template.Execute(tabw, service)
-				tabw.Flush()
+			if options.listTaskInstances {
+				item.Tasks, err = describeServiceTasks(client, instancesClient, service)
+				if err != nil {
+					return err
+				}
 			}
-		}
 
-		if serviceList.NextToken == nil {
-			break
+			results[i] = append(results[i], item)
 		}
 
-		listServicesInput.NextToken = serviceList.NextToken
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err != nil {
-		return err
+	var items []*serviceItem
+	for _, result := range results {
+		items = append(items, result...)
 	}
 
-	fmt.Println("")
-	return nil
+	return items, nil
 }
 
 func validateArgs(options *listOptions, args []string) error {
-	if len(args) != 1 {
+	if options.allClusters && len(args) != 0 {
+		return errors.New("The cluster cannot be given along with --all-clusters. Use --help for details")
+	}
+
+	if !options.allClusters && len(args) != 1 {
 		return errors.New("Invalid number of arguments for aws-ecs list command. Use --help for details")
 	}
 
-	if options.filter != "" {
-		fmt.Println("WARN: the filter is not yet use, ignoring the filters")
+	if options.allRegions && len(options.regions) > 0 {
+		return errors.New("The --regions and --all-regions flags cannot be used together")
 	}
 
+	if err := options.output.Validate(); err != nil {
+		return err
+	}
+
+	serviceFilter, err := parseFilter(options.filter)
+	if err != nil {
+		return err
+	}
+
+	options.serviceFilter = serviceFilter
 	return nil
 }
 
@@ -167,7 +312,7 @@ func ListCommand() *cobra.Command {
 	var options listOptions
 
 	cmd := &cobra.Command{
-		Use:   "list",
+		Use:   "list [cluster]",
 		Short: "List information about ECS service and Task Definitions",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			err := validateArgs(&options, args)
@@ -175,19 +320,21 @@ func ListCommand() *cobra.Command {
 				return err
 			}
 
-			options.clusterName = args[0]
+			if len(args) == 1 {
+				options.clusterName = args[0]
+			}
 			return listServices(&options)
 		},
 	}
 
-	// default output template
-	defaultTempl := "\n{{.SchedulingStrategy}}\t{{.Status}}\t{{.RunningCount}}/{{.DesiredCount}}\t{{.ServiceName}}"
-
-	cmd.PersistentFlags().StringVarP(&options.awsRegion, "aws-region", "r", "", "define AWS region.")
-	cmd.PersistentFlags().StringVarP(&options.awsProfile, "aws-profile", "p", "", "define AWS profile")
-	cmd.PersistentFlags().StringVarP(&options.awsEndpoint, "aws-endpoint", "e", "", "Define the AWS API endpoint (usually for low-level and testing")
-	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "", "Filter out service")
-	cmd.PersistentFlags().StringVarP(&options.format, "format", "", defaultTempl, "Display the format")
-	cmd.PersistentFlags().BoolVarP(&options.listTaskInstances, "list-instance", "", false, "Filter out service")
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "",
+		"Only list the matching services, e.g: 'running<desired' or 'name=api-*,launch=FARGATE,tag:team=payments'")
+	options.output.AddFlags(cmd.PersistentFlags())
+	options.output.AddLegacyFormatFlag(cmd.PersistentFlags())
+	cmd.PersistentFlags().BoolVarP(&options.allClusters, "all-clusters", "A", false, "List the services of every cluster")
+	cmd.PersistentFlags().StringSliceVarP(&options.regions, "regions", "", nil, "List the services from these regions (e.g: us-east-1,eu-west-1)")
+	cmd.PersistentFlags().BoolVarP(&options.allRegions, "all-regions", "", false, "List the services from every enabled region")
+	cmd.PersistentFlags().BoolVarP(&options.listTaskInstances, "list-instance", "", false, "List the tasks and containers of each service, and where they are running")
 	return cmd
 }
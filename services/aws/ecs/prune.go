@@ -0,0 +1,346 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// pruneOptions defines the options used on the `aws-ecs prune-taskdefs` command
+type pruneOptions struct {
+
+	// families to prune, all of them when empty
+	families []string `type:"[]string" required:"false"`
+
+	// how many of the newest revisions to keep per family
+	keep int `type:"int" required:"false"`
+
+	// deregister the revisions, the command only reports them otherwise
+	apply bool `type:"bool" required:"false"`
+
+	// how to print the summary
+	output output.Options `type:"output.Options" required:"false"`
+
+	// confirmation, the command is a dry-run unless --apply is given
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// familyPrune is the summary of one task definition family
+type familyPrune struct {
+	Family     string
+	Active     int
+	Kept       []int64
+	InUse      []int64
+	Deregister []int64
+}
+
+// pruneColumns defines the table columns of the `aws-ecs prune-taskdefs` command
+var pruneColumns = []output.Column{
+	{Header: "Family", Value: func(obj interface{}) string {
+		return obj.(*familyPrune).Family
+	}},
+	{Header: "Active", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*familyPrune).Active)
+	}},
+	{Header: "Kept", Value: func(obj interface{}) string {
+		return fmt.Sprint(len(obj.(*familyPrune).Kept))
+	}},
+	{Header: "In Use", Value: func(obj interface{}) string {
+		return revisionRanges(obj.(*familyPrune).InUse)
+	}},
+	{Header: "Deregister", Value: func(obj interface{}) string {
+		return fmt.Sprint(len(obj.(*familyPrune).Deregister))
+	}},
+	{Header: "Revisions", Wide: true, Value: func(obj interface{}) string {
+		return revisionRanges(obj.(*familyPrune).Deregister)
+	}},
+}
+
+// pruneTaskDefinitions deregisters the old revisions of the task definitions,
+// keeping the newest ones and every revision used by a service.
+func pruneTaskDefinitions(options *pruneOptions) (err error) {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	families := options.families
+	if len(families) == 0 {
+		families, err = listFamilies(client)
+		if err != nil {
+			return err
+		}
+	}
+
+	inUse, err := revisionsInUse(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	printer, err := output.NewPrinter(os.Stdout, &options.output, pruneColumns)
+	if err != nil {
+		return err
+	}
+
+	var prunes []*familyPrune
+	var total int
+	for _, family := range families {
+		prune, err := planFamilyPrune(client, family, options.keep, inUse)
+		if err != nil {
+			return err
+		}
+
+		if err := printer.Print(prune); err != nil {
+			return err
+		}
+
+		prunes = append(prunes, prune)
+		total += len(prune.Deregister)
+	}
+
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+
+	if total == 0 {
+		fmt.Fprintln(os.Stderr, "No revision to deregister")
+		return nil
+	}
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Deregister %d task definition revisions, keeping the last %d per family", total, options.keep),
+	}
+
+	for _, prune := range prunes {
+		if len(prune.Deregister) > 0 {
+			plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %s", prune.Family, revisionRanges(prune.Deregister)))
+		}
+	}
+
+	target, err := auditTarget(&options.awsOptions, "")
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	if !options.apply {
+		options.guard.DryRun = true
+	}
+
+	record := audit.Start("aws-ecs prune-taskdefs")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if !options.apply {
+		fmt.Fprintln(os.Stderr, "Use --apply to deregister the revisions")
+	}
+	if err != nil || !proceed {
+		return err
+	}
+
+	for _, prune := range prunes {
+		for _, revision := range prune.Deregister {
+			_, err := client.DeregisterTaskDefinition(&ecs.DeregisterTaskDefinitionInput{
+				TaskDefinition: aws.String(fmt.Sprintf("%s:%d", prune.Family, revision)),
+			})
+			if err != nil {
+				return fmt.Errorf("Unable to deregister %s:%d: %v", prune.Family, revision, err)
+			}
+
+			record.Add("deregistered", 1)
+		}
+
+		if len(prune.Deregister) > 0 {
+			fmt.Printf("%s: deregistered %d revisions\n", prune.Family, len(prune.Deregister))
+		}
+	}
+
+	return nil
+}
+
+// planFamilyPrune returns which revisions of the family to keep and deregister.
+// The revisions in use count toward the newest ones to keep.
+func planFamilyPrune(client *ecs.ECS, family string, keep int, inUse map[string]bool) (*familyPrune, error) {
+	prune := &familyPrune{Family: family}
+
+	input := &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Status:       aws.String(ecs.TaskDefinitionStatusActive),
+		Sort:         aws.String(ecs.SortOrderDesc),
+	}
+
+	err := client.ListTaskDefinitionsPages(input, func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+		for _, arn := range page.TaskDefinitionArns {
+			// the prefix also matches other families (e.g: api and api-worker)
+			f, revision := splitTaskDefinition(arn)
+			if f != family {
+				continue
+			}
+
+			prune.Active++
+			switch {
+			case inUse[taskDefinitionName(arn)]:
+				prune.InUse = append(prune.InUse, revision)
+			case len(prune.Kept)+len(prune.InUse) < keep:
+				prune.Kept = append(prune.Kept, revision)
+			default:
+				prune.Deregister = append(prune.Deregister, revision)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prune, nil
+}
+
+// listFamilies returns every family with active revisions
+func listFamilies(client *ecs.ECS) ([]string, error) {
+	var families []string
+
+	input := &ecs.ListTaskDefinitionFamiliesInput{Status: aws.String(ecs.TaskDefinitionFamilyStatusActive)}
+	err := client.ListTaskDefinitionFamiliesPages(input, func(page *ecs.ListTaskDefinitionFamiliesOutput, lastPage bool) bool {
+		families = append(families, aws.StringValueSlice(page.Families)...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(families)
+	return families, nil
+}
+
+// revisionsInUse returns the task definitions (family:revision) used by any
+// service of any cluster, including the ones still being deployed.
+func revisionsInUse(awsOptions *awssession.Options) (map[string]bool, error) {
+	options := &listOptions{awsOptions: *awsOptions}
+
+	clusters, err := listClusters(awsOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []*clusterLocation
+	for _, cluster := range clusters {
+		locations = append(locations, &clusterLocation{cluster: cluster})
+	}
+
+	results := make([][]*serviceItem, len(locations))
+	err = forEachLocation(locations, func(i int, location *clusterLocation) error {
+		var err error
+		results[i], err = listClusterServices(options, location)
+		return err
+	})
+
+	// pruning without knowing every service in use could deregister them
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]bool)
+	for _, items := range results {
+		for _, item := range items {
+			inUse[taskDefinitionName(item.TaskDefinition)] = true
+			for _, deployment := range item.Deployments {
+				inUse[taskDefinitionName(deployment.TaskDefinition)] = true
+			}
+		}
+	}
+
+	return inUse, nil
+}
+
+// revisionRanges formats the revisions as ranges, e.g: 1-40, 42
+func revisionRanges(revisions []int64) string {
+	if len(revisions) == 0 {
+		return "<none>"
+	}
+
+	sorted := append([]int64(nil), revisions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var ranges []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(sorted[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ", ")
+}
+
+// PruneTaskDefinitionsCommand returns the `aws-ecs prune-taskdefs` command, which
+// deregisters the old task definition revisions.
+func PruneTaskDefinitionsCommand() *cobra.Command {
+	var options pruneOptions
+
+	cmd := &cobra.Command{
+		Use:   "prune-taskdefs [family...]",
+		Short: "Deregister old task definition revisions, keeping the last ones and those in use",
+		Long: "Deregister old task definition revisions. The last --keep revisions of each family are kept,\n" +
+			"counting the ones used by a service, and the older revisions still used by a service of any\n" +
+			"cluster of the region are kept too. Only reports what would be deregistered unless --apply is given.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.keep < 1 {
+				return errors.New("The --keep flag must be at least 1")
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			options.families = args
+			return pruneTaskDefinitions(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().IntVarP(&options.keep, "keep", "k", 10, "How many of the newest revisions to keep per family")
+	cmd.PersistentFlags().BoolVarP(&options.apply, "apply", "", false, "Deregister the revisions, instead of only reporting them")
+	options.output.AddFlags(cmd.PersistentFlags())
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
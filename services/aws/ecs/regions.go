@@ -0,0 +1,219 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ecs"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+)
+
+// maxConcurrentCalls limits how many clusters (or regions) are queried at once,
+// so fanning out over every region does not hit the API rate limits.
+const maxConcurrentCalls = 10
+
+// maxConcurrentDescribes limits how many services are described at once on each
+// cluster, on top of the clusters being listed concurrently.
+const maxConcurrentDescribes = 5
+
+// the ECS calls are retried with a backoff when throttled, a large cluster listed
+// concurrently easily goes over the rate limits of the DescribeServices call.
+const (
+	maxRetries       = 8
+	minThrottleDelay = 500 * time.Millisecond
+	maxThrottleDelay = 20 * time.Second
+)
+
+// defaultRegion is used to look up the enabled regions when none is configured
+const defaultRegion = "us-east-1"
+
+// clusterLocation identifies one cluster on one region
+type clusterLocation struct {
+	region  string
+	cluster string
+}
+
+// clusterLocations returns every cluster the command should list, in a stable
+// order: by region, as given on the command line, then by cluster name.
+func clusterLocations(options *listOptions) ([]*clusterLocation, error) {
+	regions, err := listRegions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.allClusters {
+		var locations []*clusterLocation
+		for _, region := range regions {
+			locations = append(locations, &clusterLocation{region: region, cluster: options.clusterName})
+		}
+
+		return locations, nil
+	}
+
+	clusters := make([][]string, len(regions))
+	errs := make([]error, len(regions))
+	forEach(len(regions), func(i int) error {
+		clusters[i], errs[i] = listClusters(options.awsOptions.InRegion(regions[i]))
+		return nil
+	})
+
+	var locations []*clusterLocation
+	var failed []error
+	for i, region := range regions {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("%s: %v", region, errs[i]))
+			continue
+		}
+
+		for _, cluster := range clusters[i] {
+			locations = append(locations, &clusterLocation{region: region, cluster: cluster})
+		}
+	}
+
+	// nothing to list when every region failed, e.g: expired credentials
+	if len(failed) > 0 && len(failed) == len(regions) {
+		return nil, fmt.Errorf("Unable to list the clusters: %v", failed[0])
+	}
+
+	// clusters found on the other regions are still listed
+	for _, err := range failed {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+	}
+
+	return locations, nil
+}
+
+// listRegions returns the regions given with --regions, every enabled region with
+// --all-regions, or the configured region.
+func listRegions(options *listOptions) ([]string, error) {
+	if len(options.regions) > 0 {
+		return options.regions, nil
+	}
+
+	region, err := awssession.Region(&options.awsOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.allRegions {
+		return []string{region}, nil
+	}
+
+	if region == "" {
+		region = defaultRegion
+	}
+
+	client, err := ec2Client(options.awsOptions.InRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	regionList, err := client.DescribeRegions(&ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the AWS regions: %v", err)
+	}
+
+	var regions []string
+	for _, r := range regionList.Regions {
+		regions = append(regions, aws.StringValue(r.RegionName))
+	}
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// listClusters returns the name of every cluster on the region
+func listClusters(options *awssession.Options) ([]string, error) {
+	client, err := ecsClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []string
+	err = client.ListClustersPages(&ecs.ListClustersInput{}, func(page *ecs.ListClustersOutput, lastPage bool) bool {
+		for _, arn := range page.ClusterArns {
+			clusters = append(clusters, resourceID(arn))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(clusters)
+	return clusters, nil
+}
+
+// forEachLocation calls fn for every location concurrently, errors are reported
+// on the standard error and the first one is returned once all calls are done.
+func forEachLocation(locations []*clusterLocation, fn func(i int, location *clusterLocation) error) error {
+	return forEach(len(locations), func(i int) error {
+		location := locations[i]
+		if err := fn(i, location); err != nil {
+			err = fmt.Errorf("%s/%s: %v", location.region, location.cluster, err)
+			if len(locations) > 1 {
+				fmt.Fprintln(os.Stderr, "Warning:", err)
+			}
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+// forEach calls fn for 0 <= i < n, with at most maxConcurrentCalls at once, and
+// returns the error of the lowest index which failed.
+func forEach(n int, fn func(i int) error) error {
+	return forEachLimit(n, maxConcurrentCalls, fn)
+}
+
+// forEachLimit is forEach with at most limit calls at once
+func forEachLimit(n int, limit int, fn func(i int) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	semaphore := make(chan struct{}, limit)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
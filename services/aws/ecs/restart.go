@@ -0,0 +1,200 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+)
+
+// restartOptions defines the options used on the `aws-ecs restart` command
+type restartOptions struct {
+
+	// cluster running the services
+	clusterName string `type:"string" required:"true"`
+
+	// services to restart, when not selected with the filter
+	serviceNames []string `type:"[]string" required:"false"`
+
+	// select the services to restart, see the `aws-ecs list` filter
+	filter string `type:"string" required:"false"`
+
+	// the parsed filter expression
+	serviceFilter serviceFilter `type:"serviceFilter" required:"false"`
+
+	// restart every service of the cluster
+	all bool `type:"bool" required:"false"`
+
+	// how many services are restarted at a time, 0 for all of them
+	batchSize int `type:"int" required:"false"`
+
+	// how to wait for the deployments
+	wait waitOptions `type:"waitOptions" required:"false"`
+
+	// dry-run and confirmation
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// restartServices forces a new deployment of the selected services, batch by
+// batch, waiting for each batch to complete before starting the next one.
+func restartServices(options *restartOptions) (err error) {
+	services, err := selectServices(&options.awsOptions, options.clusterName, options.serviceNames, options.serviceFilter, options.all)
+	if err != nil {
+		return err
+	}
+
+	if len(services) == 0 {
+		fmt.Println("No service matches, nothing to restart")
+		return nil
+	}
+
+	batchSize := options.batchSize
+	if batchSize <= 0 {
+		batchSize = len(services)
+	}
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Restart %d services on cluster '%s', %d at a time", len(services), options.clusterName, batchSize),
+	}
+
+	for _, service := range services {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("force a new deployment of '%s'", aws.StringValue(service.ServiceName)))
+	}
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs restart")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(services); i += batchSize {
+		upperBound := i + batchSize
+		if upperBound > len(services) {
+			upperBound = len(services)
+		}
+
+		if err := restartBatch(client, services[i:upperBound], &options.wait, record); err != nil {
+			return fmt.Errorf("%v, the remaining %d services were not restarted", err, len(services)-upperBound)
+		}
+	}
+
+	return nil
+}
+
+// restartBatch forces a new deployment of every service of the batch, then waits
+// for all the deployments to complete.
+func restartBatch(client *ecs.ECS, services []*ecs.Service, wait *waitOptions, record *audit.Record) error {
+	startedAt := time.Now()
+	deployments := make([]string, len(services))
+
+	for i, service := range services {
+		updated, err := client.UpdateService(&ecs.UpdateServiceInput{
+			Cluster:            service.ClusterArn,
+			Service:            service.ServiceName,
+			ForceNewDeployment: aws.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to restart service '%s': %v", aws.StringValue(service.ServiceName), err)
+		}
+
+		record.Add("restarted", 1)
+		fmt.Printf("Service '%s' restarting\n", aws.StringValue(service.ServiceName))
+
+		if deployment := primaryDeployment(updated.Service); deployment != nil {
+			deployments[i] = aws.StringValue(deployment.Id)
+		}
+	}
+
+	if wait.noWait {
+		return nil
+	}
+
+	for i, service := range services {
+		if deployments[i] == "" {
+			continue
+		}
+
+		if err := waitForDeployment(client, service, deployments[i], startedAt, wait); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RestartCommand returns the `aws-ecs restart` command, which forces a new
+// deployment of the services, e.g: to pick up rotated secrets.
+func RestartCommand() *cobra.Command {
+	var options restartOptions
+
+	cmd := &cobra.Command{
+		Use:   "restart <cluster> [service...]",
+		Short: "Force a new deployment of ECS services, in batches",
+		Example: "  sysadmin-sk aws-ecs restart prod api worker\n" +
+			"  sysadmin-sk aws-ecs restart prod --filter 'tag:team=payments' --batch-size 3",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("Invalid number of arguments for aws-ecs restart command. Use --help for details")
+			}
+
+			serviceFilter, err := parseFilter(options.filter)
+			if err != nil {
+				return err
+			}
+
+			options.serviceFilter = serviceFilter
+			options.clusterName = args[0]
+			options.serviceNames = args[1:]
+			return restartServices(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "", "Restart the services matching the filter, see 'aws-ecs list --help'")
+	cmd.PersistentFlags().BoolVarP(&options.all, "all", "", false, "Restart every service of the cluster")
+	cmd.PersistentFlags().IntVarP(&options.batchSize, "batch-size", "b", 0, "How many services to restart at a time (default: all of them)")
+	options.wait.addFlags(cmd.PersistentFlags())
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
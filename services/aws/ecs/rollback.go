@@ -0,0 +1,206 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+)
+
+// rollbackOptions defines the options used on the `aws-ecs rollback` command
+type rollbackOptions struct {
+
+	// cluster running the service
+	clusterName string `type:"string" required:"true"`
+
+	// service to roll back
+	serviceName string `type:"string" required:"true"`
+
+	// revision to roll back to, defaults to the previous active revision
+	toRevision int64 `type:"int64" required:"false"`
+
+	// how to wait for the deployment
+	wait waitOptions `type:"waitOptions" required:"false"`
+
+	// dry-run and confirmation
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// rollbackService points the service back to a previous revision of its task
+// definition, showing what changes between both revisions.
+func rollbackService(options *rollbackOptions) (err error) {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	service, err := describeService(client, options.clusterName, options.serviceName)
+	if err != nil {
+		return err
+	}
+
+	family, revision := splitTaskDefinition(service.TaskDefinition)
+
+	toRevision := options.toRevision
+	if toRevision == 0 {
+		toRevision, err = previousRevision(client, family, revision)
+		if err != nil {
+			return err
+		}
+	}
+
+	if toRevision == revision {
+		return fmt.Errorf("Service '%s' is already running %s:%d", options.serviceName, family, revision)
+	}
+
+	current, _, err := describeTaskDefinition(client, aws.StringValue(service.TaskDefinition))
+	if err != nil {
+		return err
+	}
+
+	previous, _, err := describeTaskDefinition(client, family+":"+strconv.FormatInt(toRevision, 10))
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(previous.Status) != ecs.TaskDefinitionStatusActive {
+		return fmt.Errorf("Task definition %s:%d is %s, only active revisions can be deployed",
+			family, toRevision, aws.StringValue(previous.Status))
+	}
+
+	changes, err := diffRevisions(current, previous)
+	if err != nil {
+		return err
+	}
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Roll back service '%s' on cluster '%s' from %s:%d to %s:%d",
+			options.serviceName, options.clusterName, family, revision, family, toRevision),
+		Changes: diffLines(changes),
+	}
+
+	if len(plan.Changes) == 0 {
+		plan.Changes = []string{"no change on the task definition, only the revision differs"}
+	}
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs rollback")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	return updateServiceTaskDefinition(client, service, previous.TaskDefinitionArn, &options.wait, record)
+}
+
+// previousRevision returns the newest active revision of the family older than
+// the given one.
+func previousRevision(client *ecs.ECS, family string, revision int64) (int64, error) {
+	input := &ecs.ListTaskDefinitionsInput{
+		FamilyPrefix: aws.String(family),
+		Status:       aws.String(ecs.TaskDefinitionStatusActive),
+		Sort:         aws.String(ecs.SortOrderDesc),
+	}
+
+	var previous int64
+	err := client.ListTaskDefinitionsPages(input, func(page *ecs.ListTaskDefinitionsOutput, lastPage bool) bool {
+		for _, arn := range page.TaskDefinitionArns {
+			// the prefix also matches other families (e.g: api and api-worker)
+			f, r := splitTaskDefinition(arn)
+			if f == family && r < revision {
+				previous = r
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if previous == 0 {
+		return 0, fmt.Errorf("No active revision of %s older than %d, use --to-revision to pick one", family, revision)
+	}
+
+	return previous, nil
+}
+
+// diffRevisions returns what changes from one task definition to another
+func diffRevisions(from *ecs.TaskDefinition, to *ecs.TaskDefinition) ([]*fieldChange, error) {
+	fromDocument, err := taskDefinitionDocument(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toDocument, err := taskDefinitionDocument(to)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffTaskDefinitions(fromDocument, toDocument), nil
+}
+
+// RollbackCommand returns the `aws-ecs rollback` command, which points a service
+// back to a previous revision of its task definition.
+func RollbackCommand() *cobra.Command {
+	var options rollbackOptions
+
+	cmd := &cobra.Command{
+		Use:   "rollback <cluster> <service>",
+		Short: "Roll back an ECS service to a previous task definition revision",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("Invalid number of arguments for aws-ecs rollback command. Use --help for details")
+			}
+
+			if options.toRevision < 0 {
+				return errors.New("The --to-revision flag must be a positive revision number")
+			}
+
+			options.clusterName = args[0]
+			options.serviceName = args[1]
+			return rollbackService(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().Int64VarP(&options.toRevision, "to-revision", "", 0, "Revision to roll back to (default: the previous active revision)")
+	options.wait.addFlags(cmd.PersistentFlags())
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
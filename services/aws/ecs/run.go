@@ -0,0 +1,450 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+	"github.com/raffs/sysadmin-sk/utils"
+)
+
+// how often the task and its logs are polled while it runs
+const runPollInterval = 3 * time.Second
+
+// runOptions defines the options used on the `aws-ecs run` command
+type runOptions struct {
+
+	// cluster to run the task on
+	clusterName string `type:"string" required:"true"`
+
+	// task definition to run, family, family:revision or ARN
+	taskDefinition string `type:"string" required:"true"`
+
+	// command overriding the container command
+	command []string `type:"[]string" required:"false"`
+
+	// container to override, required when the task has several containers
+	container string `type:"string" required:"false"`
+
+	// environment variables added to the container, as KEY=VALUE
+	env []string `type:"[]string" required:"false"`
+
+	// EC2, FARGATE or EXTERNAL
+	launchType string `type:"string" required:"false"`
+
+	// service to copy the launch type and network configuration from
+	fromService string `type:"string" required:"false"`
+
+	// network configuration, for the awsvpc network mode
+	subnets        []string `type:"[]string" required:"false"`
+	securityGroups []string `type:"[]string" required:"false"`
+	assignPublicIP bool     `type:"bool" required:"false"`
+
+	// return as soon as the task is started
+	noWait bool `type:"bool" required:"false"`
+
+	// how long to wait for the task to stop
+	timeout time.Duration `type:"duration" required:"false"`
+
+	// do not print the container logs while waiting
+	noLogs bool `type:"bool" required:"false"`
+
+	// dry-run and confirmation
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// runTask starts a one-off task, waits for it to stop and returns an error with
+// the container exit code when it's not zero.
+func runTask(options *runOptions) (err error) {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	taskDefinition, _, err := describeTaskDefinition(client, options.taskDefinition)
+	if err != nil {
+		return fmt.Errorf("Unable to describe task definition %s: %v", options.taskDefinition, err)
+	}
+
+	container, err := runContainer(taskDefinition, options)
+	if err != nil {
+		return err
+	}
+
+	input, plan, err := runTaskInput(client, taskDefinition, container, options)
+	if err != nil {
+		return err
+	}
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs run")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	started, err := client.RunTask(input)
+	if err != nil {
+		return fmt.Errorf("Unable to run task: %v", err)
+	}
+
+	for _, failure := range started.Failures {
+		return fmt.Errorf("Unable to run task: %s %s", aws.StringValue(failure.Reason), aws.StringValue(failure.Detail))
+	}
+
+	if len(started.Tasks) == 0 {
+		return errors.New("Unable to run task, no task was started")
+	}
+
+	task := started.Tasks[0]
+	record.Add("started", 1)
+	fmt.Printf("Started task %s\n", resourceID(task.TaskArn))
+
+	if options.noWait {
+		return nil
+	}
+
+	return waitForTask(client, task, container, options)
+}
+
+// runContainer returns the container whose exit code is the result of the task,
+// and which the overrides apply to.
+func runContainer(taskDefinition *ecs.TaskDefinition, options *runOptions) (*ecs.ContainerDefinition, error) {
+	containers := taskDefinition.ContainerDefinitions
+
+	if options.container != "" {
+		container := findContainer(containers, options.container)
+		if container == nil {
+			return nil, fmt.Errorf("Task definition %s has no container named '%s'",
+				taskDefinitionName(taskDefinition.TaskDefinitionArn), options.container)
+		}
+		return container, nil
+	}
+
+	if len(containers) == 1 {
+		return containers[0], nil
+	}
+
+	if len(options.command) > 0 || len(options.env) > 0 {
+		return nil, fmt.Errorf("Task definition %s has %d containers, use --container to pick which one to override",
+			taskDefinitionName(taskDefinition.TaskDefinitionArn), len(containers))
+	}
+
+	// without overrides, the result is the one of the first essential container
+	for _, container := range containers {
+		if aws.BoolValue(container.Essential) {
+			return container, nil
+		}
+	}
+
+	return containers[0], nil
+}
+
+// runTaskInput returns the RunTask input, along with the plan describing it
+func runTaskInput(client *ecs.ECS, taskDefinition *ecs.TaskDefinition, container *ecs.ContainerDefinition, options *runOptions) (*ecs.RunTaskInput, *guard.Plan, error) {
+	input := &ecs.RunTaskInput{
+		Cluster:        aws.String(options.clusterName),
+		TaskDefinition: taskDefinition.TaskDefinitionArn,
+		Count:          aws.Int64(1),
+		StartedBy:      aws.String("sysadmin-sk"),
+	}
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Run task %s on cluster '%s'", taskDefinitionName(taskDefinition.TaskDefinitionArn), options.clusterName),
+	}
+
+	override := &ecs.ContainerOverride{Name: container.Name}
+	if len(options.command) > 0 {
+		override.Command = aws.StringSlice(options.command)
+		plan.Changes = append(plan.Changes, fmt.Sprintf("command: %s", strings.Join(options.command, " ")))
+	}
+
+	for _, variable := range options.env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, nil, fmt.Errorf("Invalid environment variable '%s', expected KEY=VALUE", variable)
+		}
+
+		override.Environment = append(override.Environment, &ecs.KeyValuePair{
+			Name:  aws.String(parts[0]),
+			Value: aws.String(parts[1]),
+		})
+
+		// only the names, the values may be secrets
+		plan.Changes = append(plan.Changes, fmt.Sprintf("environment: %s", parts[0]))
+	}
+
+	if override.Command != nil || override.Environment != nil {
+		input.Overrides = &ecs.TaskOverride{ContainerOverrides: []*ecs.ContainerOverride{override}}
+	}
+
+	if options.fromService != "" {
+		service, err := describeService(client, options.clusterName, options.fromService)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		input.LaunchType = service.LaunchType
+		input.CapacityProviderStrategy = service.CapacityProviderStrategy
+		input.PlatformVersion = service.PlatformVersion
+		input.NetworkConfiguration = service.NetworkConfiguration
+		plan.Changes = append(plan.Changes, fmt.Sprintf("launch type and network configuration of service '%s'", options.fromService))
+	}
+
+	if options.launchType != "" {
+		input.LaunchType = aws.String(strings.ToUpper(options.launchType))
+		input.CapacityProviderStrategy = nil
+	}
+
+	if len(options.subnets) > 0 {
+		assignPublicIP := ecs.AssignPublicIpDisabled
+		if options.assignPublicIP {
+			assignPublicIP = ecs.AssignPublicIpEnabled
+		}
+
+		input.NetworkConfiguration = &ecs.NetworkConfiguration{
+			AwsvpcConfiguration: &ecs.AwsVpcConfiguration{
+				Subnets:        aws.StringSlice(options.subnets),
+				SecurityGroups: aws.StringSlice(options.securityGroups),
+				AssignPublicIp: aws.String(assignPublicIP),
+			},
+		}
+	}
+
+	if input.LaunchType != nil {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("launch type: %s", aws.StringValue(input.LaunchType)))
+	}
+
+	return input, plan, nil
+}
+
+// waitForTask waits for the task to stop, printing the container logs, and
+// returns an error with the container exit code when it's not zero.
+func waitForTask(client *ecs.ECS, task *ecs.Task, container *ecs.ContainerDefinition, options *runOptions) error {
+	var logs *logStreamer
+	if !options.noLogs {
+		logs = newLogStreamer(&options.awsOptions, container, task)
+	}
+
+	deadline := time.Now().Add(options.timeout)
+	lastStatus := aws.StringValue(task.LastStatus)
+	fmt.Printf("%s  task %s\n", time.Now().Format("15:04:05"), lastStatus)
+
+	for {
+		description, err := client.DescribeTasks(&ecs.DescribeTasksInput{
+			Cluster: task.ClusterArn,
+			Tasks:   []*string{task.TaskArn},
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(description.Tasks) == 0 {
+			return fmt.Errorf("Unable to find task %s", resourceID(task.TaskArn))
+		}
+
+		task = description.Tasks[0]
+		if status := aws.StringValue(task.LastStatus); status != lastStatus {
+			fmt.Printf("%s  task %s\n", time.Now().Format("15:04:05"), status)
+			lastStatus = status
+		}
+
+		logs.print()
+
+		if lastStatus == ecs.DesiredStatusStopped {
+			// the last lines may land after the task stopped
+			time.Sleep(runPollInterval)
+			logs.print()
+
+			return taskResult(task, aws.StringValue(container.Name))
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for task %s to stop, it's still running", resourceID(task.TaskArn))
+		}
+
+		time.Sleep(runPollInterval)
+	}
+}
+
+// taskResult returns nil when the container exited with 0, an ExitError with the
+// container exit code otherwise.
+func taskResult(task *ecs.Task, name string) error {
+	for _, container := range task.Containers {
+		if aws.StringValue(container.Name) != name {
+			continue
+		}
+
+		if container.ExitCode == nil {
+			return fmt.Errorf("Task %s stopped without running container '%s': %s %s", resourceID(task.TaskArn),
+				name, aws.StringValue(task.StoppedReason), aws.StringValue(container.Reason))
+		}
+
+		code := aws.Int64Value(container.ExitCode)
+		fmt.Printf("Container '%s' exited with code %d\n", name, code)
+		if code == 0 {
+			return nil
+		}
+
+		return &utils.ExitError{
+			Code: int(code),
+			Err:  fmt.Errorf("Container '%s' exited with code %d", name, code),
+		}
+	}
+
+	return fmt.Errorf("Task %s has no container '%s'", resourceID(task.TaskArn), name)
+}
+
+// logStreamer prints the new lines of the container logs, when it uses the
+// awslogs driver with a stream prefix (otherwise the stream name is unknown).
+type logStreamer struct {
+	client    *cloudwatchlogs.CloudWatchLogs
+	group     string
+	stream    string
+	nextToken *string
+}
+
+func newLogStreamer(options *awssession.Options, container *ecs.ContainerDefinition, task *ecs.Task) *logStreamer {
+	config := container.LogConfiguration
+	if config == nil || aws.StringValue(config.LogDriver) != ecs.LogDriverAwslogs {
+		return nil
+	}
+
+	group := aws.StringValue(config.Options["awslogs-group"])
+	prefix := aws.StringValue(config.Options["awslogs-stream-prefix"])
+	if group == "" || prefix == "" {
+		return nil
+	}
+
+	sess, err := awssession.New(options.InRegion(aws.StringValue(config.Options["awslogs-region"])))
+	if err != nil {
+		return nil
+	}
+
+	return &logStreamer{
+		client: cloudwatchlogs.New(sess),
+		group:  group,
+		stream: fmt.Sprintf("%s/%s/%s", prefix, aws.StringValue(container.Name), resourceID(task.TaskArn)),
+	}
+}
+
+// print prints the log lines since the last call
+func (l *logStreamer) print() {
+	if l == nil {
+		return
+	}
+
+	for {
+		events, err := l.client.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(l.group),
+			LogStreamName: aws.String(l.stream),
+			NextToken:     l.nextToken,
+			StartFromHead: aws.Bool(true),
+		})
+		if err != nil {
+			// the stream only exists once the container started
+			if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceNotFoundException {
+				fmt.Fprintf(os.Stderr, "Warning: unable to read the logs of %s: %v\n", l.stream, err)
+			}
+			return
+		}
+
+		for _, event := range events.Events {
+			fmt.Println(aws.StringValue(event.Message))
+		}
+
+		// the same token is returned once there's nothing new
+		done := aws.StringValue(events.NextForwardToken) == aws.StringValue(l.nextToken)
+		l.nextToken = events.NextForwardToken
+		if done || len(events.Events) == 0 {
+			return
+		}
+	}
+}
+
+// RunCommand returns the `aws-ecs run` command, which runs one-off tasks (e.g:
+// migrations) and exits with the exit code of the container.
+func RunCommand() *cobra.Command {
+	var options runOptions
+
+	cmd := &cobra.Command{
+		Use:   "run <cluster> <task-definition> [-- command...]",
+		Short: "Run a one-off ECS task, wait for it and exit with the container exit code",
+		Example: "  sysadmin-sk aws-ecs run prod api --from-service api --container-env DRY_RUN=false -- python manage.py migrate\n" +
+			"  sysadmin-sk aws-ecs run staging cleanup:3 --launch-type FARGATE --subnets subnet-1,subnet-2",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("Invalid number of arguments for aws-ecs run command. Use --help for details")
+			}
+
+			// the command must be given after --, so its flags are not taken as ours
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 && dash != 2 {
+				return errors.New("The command must be given after --, e.g: aws-ecs run prod api -- ./migrate.sh")
+			} else if dash < 0 && len(args) > 2 {
+				return errors.New("Invalid number of arguments for aws-ecs run command, give the command after --")
+			}
+
+			if len(options.securityGroups) > 0 && len(options.subnets) == 0 {
+				return errors.New("The --security-groups flag requires --subnets")
+			}
+
+			options.clusterName = args[0]
+			options.taskDefinition = args[1]
+			options.command = args[2:]
+			return runTask(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.container, "container", "c", "", "Container to override (default: the only container)")
+	cmd.PersistentFlags().StringArrayVarP(&options.env, "container-env", "", nil, "Environment variable to set on the container, as KEY=VALUE (repeatable)")
+	cmd.PersistentFlags().StringVarP(&options.launchType, "launch-type", "", "", "Launch type: EC2, FARGATE or EXTERNAL")
+	cmd.PersistentFlags().StringVarP(&options.fromService, "from-service", "", "", "Copy the launch type and network configuration of this service")
+	cmd.PersistentFlags().StringSliceVarP(&options.subnets, "subnets", "", nil, "Subnets of the task, for the awsvpc network mode")
+	cmd.PersistentFlags().StringSliceVarP(&options.securityGroups, "security-groups", "", nil, "Security groups of the task, for the awsvpc network mode")
+	cmd.PersistentFlags().BoolVarP(&options.assignPublicIP, "assign-public-ip", "", false, "Assign a public IP to the task, for the awsvpc network mode")
+	cmd.PersistentFlags().BoolVarP(&options.noWait, "no-wait", "", false, "Do not wait for the task to stop")
+	cmd.PersistentFlags().DurationVarP(&options.timeout, "timeout", "", time.Hour, "How long to wait for the task to stop")
+	cmd.PersistentFlags().BoolVarP(&options.noLogs, "no-logs", "", false, "Do not print the container logs (awslogs driver only)")
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
@@ -0,0 +1,388 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+)
+
+// scaleOptions defines the options used on the `aws-ecs scale` command
+type scaleOptions struct {
+
+	// cluster running the services
+	clusterName string `type:"string" required:"true"`
+
+	// services to scale, when not selected with the filter
+	serviceNames []string `type:"[]string" required:"false"`
+
+	// select the services to scale, see the `aws-ecs list` filter
+	filter string `type:"string" required:"false"`
+
+	// the parsed filter expression
+	serviceFilter serviceFilter `type:"serviceFilter" required:"false"`
+
+	// scale every service of the cluster
+	all bool `type:"bool" required:"false"`
+
+	// new desired count, -1 when not given
+	count int64 `type:"int64" required:"false"`
+
+	// multiply the desired count by this factor, 0 when not given
+	factor float64 `type:"float64" required:"false"`
+
+	// scale the services down to zero
+	toZero bool `type:"bool" required:"false"`
+
+	// file to save the desired counts to, before scaling
+	saveState string `type:"string" required:"false"`
+
+	// file to restore the desired counts from
+	restoreFrom string `type:"string" required:"false"`
+
+	// dry-run and confirmation
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// scaleState is the content of the --save-state and --restore-from files
+type scaleState struct {
+	Cluster  string           `json:"cluster"`
+	SavedAt  time.Time        `json:"savedAt"`
+	Services map[string]int64 `json:"services"`
+}
+
+// scaleChange is the new desired count of one service
+type scaleChange struct {
+	service *ecs.Service
+	count   int64
+}
+
+// scaleServices sets the desired count of the selected services
+func scaleServices(options *scaleOptions) (err error) {
+	var state *scaleState
+	if options.restoreFrom != "" {
+		state, err = readScaleState(options.restoreFrom)
+		if err != nil {
+			return err
+		}
+
+		if options.clusterName == "" {
+			options.clusterName = state.Cluster
+		}
+
+		if options.clusterName != state.Cluster {
+			return fmt.Errorf("State file %s was saved from cluster '%s', not '%s'", options.restoreFrom, state.Cluster, options.clusterName)
+		}
+
+	}
+
+	var services []*ecs.Service
+	if state != nil {
+		services, err = describeSavedServices(options, state)
+	} else {
+		services, err = selectServices(&options.awsOptions, options.clusterName, options.serviceNames, options.serviceFilter, options.all)
+	}
+	if err != nil {
+		return err
+	}
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Scale services on cluster '%s'", options.clusterName),
+	}
+
+	var changes []*scaleChange
+	for _, service := range services {
+		name := aws.StringValue(service.ServiceName)
+		if aws.StringValue(service.SchedulingStrategy) == ecs.SchedulingStrategyDaemon {
+			fmt.Fprintf(os.Stderr, "Skipping service '%s', daemon services can't be scaled\n", name)
+			continue
+		}
+
+		current := aws.Int64Value(service.DesiredCount)
+		count := options.newCount(current)
+		if state != nil {
+			saved, ok := state.Services[name]
+			if !ok {
+				return fmt.Errorf("Service '%s' is not part of the state file %s", name, options.restoreFrom)
+			}
+			count = saved
+		}
+
+		if count == current {
+			continue
+		}
+
+		changes = append(changes, &scaleChange{service: service, count: count})
+		plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %d -> %d", name, current, count))
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("The services already have the expected desired count, nothing to scale")
+		return nil
+	}
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs scale")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	if options.saveState != "" {
+		if err := saveScaleState(options.saveState, options.clusterName, changes); err != nil {
+			return err
+		}
+		fmt.Printf("Saved the desired counts to %s\n", options.saveState)
+	}
+
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	var failed int64
+	for _, change := range changes {
+		name := aws.StringValue(change.service.ServiceName)
+
+		_, updateErr := client.UpdateService(&ecs.UpdateServiceInput{
+			Cluster:      change.service.ClusterArn,
+			Service:      change.service.ServiceName,
+			DesiredCount: aws.Int64(change.count),
+		})
+		if updateErr != nil {
+			fmt.Fprintf(os.Stderr, "Unable to scale service '%s': %v\n", name, updateErr)
+			failed++
+			continue
+		}
+
+		fmt.Printf("Service '%s' scaled to %d\n", name, change.count)
+		record.Add("scaled", 1)
+	}
+
+	if failed > 0 {
+		record.Add("failed", failed)
+		return fmt.Errorf("Unable to scale %d of %d services", failed, len(changes))
+	}
+
+	return nil
+}
+
+// newCount returns the desired count of a service given its current one
+func (o *scaleOptions) newCount(current int64) int64 {
+	switch {
+	case o.toZero:
+		return 0
+	case o.factor > 0:
+		// services running something keep at least one task
+		count := int64(math.Round(float64(current) * o.factor))
+		if count == 0 && current > 0 {
+			count = 1
+		}
+		return count
+	}
+
+	return o.count
+}
+
+// readScaleState reads a file saved with --save-state
+func readScaleState(path string) (*scaleState, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state scaleState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("Invalid state file %s: %v", path, err)
+	}
+
+	return &state, nil
+}
+
+// saveScaleState saves the current desired count of the services about to be
+// scaled. Services already scaled to zero keep the count saved on the existing
+// file, so scaling down twice does not lose the counts to restore.
+func saveScaleState(path string, cluster string, changes []*scaleChange) error {
+	state := &scaleState{Cluster: cluster, Services: make(map[string]int64)}
+
+	if existing, err := readScaleState(path); err == nil && existing.Cluster == cluster {
+		state.Services = existing.Services
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, change := range changes {
+		name := aws.StringValue(change.service.ServiceName)
+		count := aws.Int64Value(change.service.DesiredCount)
+
+		if _, ok := state.Services[name]; ok && count == 0 {
+			continue
+		}
+
+		state.Services[name] = count
+	}
+
+	state.SavedAt = time.Now().UTC()
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// describeSavedServices returns the services to restore: the ones given by name or
+// every service of the state file, matching the filter. The services deleted
+// since the state was saved are skipped.
+func describeSavedServices(options *scaleOptions, state *scaleState) ([]*ecs.Service, error) {
+	names := options.serviceNames
+	if len(names) == 0 {
+		for name := range state.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*ecs.Service
+	for _, name := range names {
+		description, err := client.DescribeServices(&ecs.DescribeServicesInput{
+			Cluster:  aws.String(options.clusterName),
+			Services: []*string{aws.String(name)},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(description.Services) == 0 || aws.StringValue(description.Services[0].Status) == "INACTIVE" {
+			fmt.Fprintf(os.Stderr, "Skipping service '%s', it no longer exists on cluster '%s'\n", name, options.clusterName)
+			continue
+		}
+
+		if options.serviceFilter.Match(description.Services[0]) {
+			services = append(services, description.Services[0])
+		}
+	}
+
+	return services, nil
+}
+
+// validateScaleArgs checks that exactly one way of scaling is given
+func validateScaleArgs(options *scaleOptions, args []string) error {
+	modes := 0
+	for _, given := range []bool{options.count >= 0, options.factor != 0, options.toZero, options.restoreFrom != ""} {
+		if given {
+			modes++
+		}
+	}
+
+	if modes != 1 {
+		return errors.New("Give exactly one of --count, --factor, --to-zero or --restore-from")
+	}
+
+	if options.factor < 0 {
+		return errors.New("The --factor flag must be a positive number")
+	}
+
+	if options.saveState != "" && options.restoreFrom != "" {
+		return errors.New("The --save-state and --restore-from flags cannot be used together")
+	}
+
+	if len(args) == 0 && options.restoreFrom == "" {
+		return errors.New("Invalid number of arguments for aws-ecs scale command. Use --help for details")
+	}
+
+	if len(args) > 1 && (options.filter != "" || options.all) {
+		return errors.New("Give the services by name or select them with --filter or --all, not both")
+	}
+
+	serviceFilter, err := parseFilter(options.filter)
+	if err != nil {
+		return err
+	}
+
+	options.serviceFilter = serviceFilter
+	return nil
+}
+
+// ScaleCommand returns the `aws-ecs scale` command, which sets the desired count
+// of one service, a filtered set of services or a whole cluster.
+func ScaleCommand() *cobra.Command {
+	var options scaleOptions
+
+	cmd := &cobra.Command{
+		Use:   "scale <cluster> [service...]",
+		Short: "Set the desired count of ECS services",
+		Example: "  sysadmin-sk aws-ecs scale prod api --count 4\n" +
+			"  sysadmin-sk aws-ecs scale staging --filter 'tag:team=payments' --factor 0.5\n" +
+			"  sysadmin-sk aws-ecs scale staging --all --to-zero --save-state staging.json\n" +
+			"  sysadmin-sk aws-ecs scale --restore-from staging.json",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateScaleArgs(&options, args); err != nil {
+				return err
+			}
+
+			if len(args) > 0 {
+				options.clusterName = args[0]
+				options.serviceNames = args[1:]
+			}
+			return scaleServices(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.filter, "filter", "f", "", "Scale the services matching the filter, see 'aws-ecs list --help'")
+	cmd.PersistentFlags().BoolVarP(&options.all, "all", "", false, "Scale every service of the cluster")
+	cmd.PersistentFlags().Int64VarP(&options.count, "count", "c", -1, "New desired count")
+	cmd.PersistentFlags().Float64VarP(&options.factor, "factor", "", 0, "Multiply the desired count by this factor (e.g: 0.5)")
+	cmd.PersistentFlags().BoolVarP(&options.toZero, "to-zero", "", false, "Scale the services down to zero")
+	cmd.PersistentFlags().StringVarP(&options.saveState, "save-state", "", "", "Save the desired counts to this file before scaling")
+	cmd.PersistentFlags().StringVarP(&options.restoreFrom, "restore-from", "", "", "Restore the desired counts saved with --save-state")
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
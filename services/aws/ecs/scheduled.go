@@ -0,0 +1,484 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// how far back to look for the last invocation of the rules, the EventBridge
+// metrics are kept with an hourly resolution.
+const invocationsWindow = 14 * 24 * time.Hour
+
+// scheduledOptions defines the options used on the `aws-ecs list-scheduled` command
+type scheduledOptions struct {
+
+	// cluster the rules run tasks on
+	clusterName string `type:"string" required:"true"`
+
+	// rules to enable
+	enable []string `type:"[]string" required:"false"`
+
+	// rules to disable
+	disable []string `type:"[]string" required:"false"`
+
+	// how to print the rules
+	output output.Options `type:"output.Options" required:"false"`
+
+	// Define how to ask for confirmation before changing the rules
+	guard guard.Options `type:"guard.Options" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// scheduledTask is an EventBridge rule target running tasks on the cluster
+type scheduledTask struct {
+	RuleName           string
+	State              string
+	ScheduleExpression string `json:",omitempty"`
+	EventPattern       string `json:",omitempty"`
+	Description        string `json:",omitempty"`
+	TargetID           string
+	TaskDefinition     string
+	TaskCount          int64
+	LaunchType         string     `json:",omitempty"`
+	Input              string     `json:",omitempty"`
+	LastInvocation     *time.Time `json:",omitempty"`
+}
+
+// scheduledColumns defines the table columns of the `aws-ecs list-scheduled` command
+var scheduledColumns = []output.Column{
+	{Header: "Rule", Value: func(obj interface{}) string {
+		return obj.(*scheduledTask).RuleName
+	}},
+	{Header: "State", Value: func(obj interface{}) string {
+		return obj.(*scheduledTask).State
+	}},
+	{Header: "Schedule", Value: func(obj interface{}) string {
+		task := obj.(*scheduledTask)
+		if task.ScheduleExpression == "" && task.EventPattern != "" {
+			return "<event pattern>"
+		}
+		return valueOrNone(task.ScheduleExpression)
+	}},
+	{Header: "Task Definition", Value: func(obj interface{}) string {
+		return obj.(*scheduledTask).TaskDefinition
+	}},
+	{Header: "Count", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*scheduledTask).TaskCount)
+	}},
+	{Header: "Overrides", Value: func(obj interface{}) string {
+		return valueOrNone(containerOverrides(obj.(*scheduledTask).Input))
+	}},
+	{Header: "Last Invocation", Value: func(obj interface{}) string {
+		if task := obj.(*scheduledTask); task.LastInvocation != nil {
+			return output.Age(task.LastInvocation)
+		}
+		return "<none>"
+	}},
+	{Header: "Launch Type", Wide: true, Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*scheduledTask).LaunchType)
+	}},
+	{Header: "Target", Wide: true, Value: func(obj interface{}) string {
+		return obj.(*scheduledTask).TargetID
+	}},
+	{Header: "Description", Wide: true, Value: func(obj interface{}) string {
+		return valueOrNone(obj.(*scheduledTask).Description)
+	}},
+}
+
+// listScheduledTasks prints the EventBridge rules running tasks on the cluster or,
+// with --enable and --disable, changes their state.
+func listScheduledTasks(options *scheduledOptions) error {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	sess, err := awssession.New(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+	eventsClient := eventbridge.New(sess)
+
+	clusterArn, err := describeClusterArn(client, options.clusterName)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := describeScheduledTasks(eventsClient, clusterArn)
+	if err != nil {
+		return err
+	}
+
+	if len(options.enable) > 0 || len(options.disable) > 0 {
+		return toggleRules(eventsClient, options, tasks)
+	}
+
+	printer, err := output.NewPrinter(os.Stdout, &options.output, scheduledColumns)
+	if err != nil {
+		return err
+	}
+
+	metricsClient := cloudwatch.New(sess)
+	err = forEach(len(tasks), func(i int) error {
+		var err error
+		tasks[i].LastInvocation, err = lastInvocation(metricsClient, tasks[i].RuleName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if err := printer.Print(task); err != nil {
+			return err
+		}
+	}
+
+	return printer.Flush()
+}
+
+// describeClusterArn returns the ARN of the cluster, which is what the rule targets point to
+func describeClusterArn(client *ecs.ECS, cluster string) (string, error) {
+	description, err := client.DescribeClusters(&ecs.DescribeClustersInput{Clusters: []*string{aws.String(cluster)}})
+	if err != nil {
+		return "", err
+	}
+
+	if len(description.Clusters) == 0 {
+		return "", fmt.Errorf("Cluster '%s' not found", cluster)
+	}
+
+	return aws.StringValue(description.Clusters[0].ClusterArn), nil
+}
+
+// describeScheduledTasks returns the targets of the rules running tasks on the
+// cluster, sorted by rule name.
+func describeScheduledTasks(client *eventbridge.EventBridge, clusterArn string) ([]*scheduledTask, error) {
+	var ruleNames []*string
+	listInput := &eventbridge.ListRuleNamesByTargetInput{TargetArn: aws.String(clusterArn)}
+	for {
+		page, err := client.ListRuleNamesByTarget(listInput)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to list the EventBridge rules: %v", err)
+		}
+
+		ruleNames = append(ruleNames, page.RuleNames...)
+		if page.NextToken == nil {
+			break
+		}
+
+		listInput.NextToken = page.NextToken
+	}
+
+	var tasks []*scheduledTask
+	for _, name := range ruleNames {
+		rule, err := client.DescribeRule(&eventbridge.DescribeRuleInput{Name: name})
+		if err != nil {
+			return nil, err
+		}
+
+		var targets []*eventbridge.Target
+		err = listTargetsByRule(client, name, func(page []*eventbridge.Target) {
+			targets = append(targets, page...)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, target := range targets {
+			if aws.StringValue(target.Arn) != clusterArn || target.EcsParameters == nil {
+				continue
+			}
+
+			task := &scheduledTask{
+				RuleName:           aws.StringValue(rule.Name),
+				State:              aws.StringValue(rule.State),
+				ScheduleExpression: aws.StringValue(rule.ScheduleExpression),
+				EventPattern:       aws.StringValue(rule.EventPattern),
+				Description:        aws.StringValue(rule.Description),
+				TargetID:           aws.StringValue(target.Id),
+				TaskDefinition:     taskDefinitionName(target.EcsParameters.TaskDefinitionArn),
+				TaskCount:          aws.Int64Value(target.EcsParameters.TaskCount),
+				LaunchType:         aws.StringValue(target.EcsParameters.LaunchType),
+				Input:              aws.StringValue(target.Input),
+			}
+			if target.InputTransformer != nil {
+				task.Input = aws.StringValue(target.InputTransformer.InputTemplate)
+			}
+
+			tasks = append(tasks, task)
+		}
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].RuleName < tasks[j].RuleName
+	})
+
+	return tasks, nil
+}
+
+// listTargetsByRule calls fn with every page of targets of the rule, the SDK has
+// no paginator for ListTargetsByRule.
+func listTargetsByRule(client *eventbridge.EventBridge, rule *string, fn func([]*eventbridge.Target)) error {
+	input := &eventbridge.ListTargetsByRuleInput{Rule: rule}
+	for {
+		page, err := client.ListTargetsByRule(input)
+		if err != nil {
+			return err
+		}
+
+		fn(page.Targets)
+		if page.NextToken == nil {
+			return nil
+		}
+
+		input.NextToken = page.NextToken
+	}
+}
+
+// lastInvocation returns the last hour the rule invoked its targets, nil when
+// it did not within the invocations window.
+func lastInvocation(client *cloudwatch.CloudWatch, rule string) (*time.Time, error) {
+	now := time.Now()
+	statistics, err := client.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/Events"),
+		MetricName: aws.String("Invocations"),
+		Dimensions: []*cloudwatch.Dimension{{Name: aws.String("RuleName"), Value: aws.String(rule)}},
+		StartTime:  aws.Time(now.Add(-invocationsWindow)),
+		EndTime:    aws.Time(now),
+		Period:     aws.Int64(3600),
+		Statistics: []*string{aws.String(cloudwatch.StatisticSum)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the invocations of rule %s: %v", rule, err)
+	}
+
+	var last *time.Time
+	for _, datapoint := range statistics.Datapoints {
+		if aws.Float64Value(datapoint.Sum) > 0 && (last == nil || datapoint.Timestamp.After(*last)) {
+			last = datapoint.Timestamp
+		}
+	}
+
+	return last, nil
+}
+
+// containerOverrides summarizes the container overrides of the target input,
+// e.g: app: command=./manage.py migrate env=DEBUG
+func containerOverrides(input string) string {
+	if input == "" {
+		return ""
+	}
+
+	var overrides struct {
+		ContainerOverrides []struct {
+			Name        string
+			Command     []string
+			Environment []struct{ Name string }
+			Cpu         int64
+			Memory      int64
+		}
+	}
+
+	if err := json.Unmarshal([]byte(input), &overrides); err != nil {
+		return input
+	}
+
+	var containers []string
+	for _, container := range overrides.ContainerOverrides {
+		parts := []string{container.Name + ":"}
+		if len(container.Command) > 0 {
+			parts = append(parts, "command="+strings.Join(container.Command, " "))
+		}
+
+		var names []string
+		for _, variable := range container.Environment {
+			names = append(names, variable.Name)
+		}
+		if len(names) > 0 {
+			parts = append(parts, "env="+strings.Join(names, ","))
+		}
+
+		if container.Cpu > 0 {
+			parts = append(parts, fmt.Sprintf("cpu=%d", container.Cpu))
+		}
+		if container.Memory > 0 {
+			parts = append(parts, fmt.Sprintf("memory=%d", container.Memory))
+		}
+
+		containers = append(containers, strings.Join(parts, " "))
+	}
+
+	return strings.Join(containers, "; ")
+}
+
+// wantedRuleStates returns the state wanted for each rule given with --enable and
+// --disable. A rule given twice with the same flag is fine, with both is not.
+func wantedRuleStates(enable []string, disable []string) (map[string]string, error) {
+	states := make(map[string]string)
+	for _, name := range enable {
+		states[name] = eventbridge.RuleStateEnabled
+	}
+
+	for _, name := range disable {
+		if states[name] == eventbridge.RuleStateEnabled {
+			return nil, fmt.Errorf("Rule '%s' is both enabled and disabled", name)
+		}
+		states[name] = eventbridge.RuleStateDisabled
+	}
+
+	return states, nil
+}
+
+// toggleRules enables and disables the given rules, which must run tasks on the cluster
+func toggleRules(client *eventbridge.EventBridge, options *scheduledOptions, tasks []*scheduledTask) (err error) {
+	states := make(map[string]string)
+	for _, task := range tasks {
+		states[task.RuleName] = task.State
+	}
+
+	plan := &guard.Plan{
+		Action: fmt.Sprintf("Change the scheduled tasks of cluster '%s'", options.clusterName),
+	}
+
+	wanted, err := wantedRuleStates(options.enable, options.disable)
+	if err != nil {
+		return err
+	}
+
+	var wantedNames []string
+	for name := range wanted {
+		wantedNames = append(wantedNames, name)
+	}
+	sort.Strings(wantedNames)
+
+	changes := make(map[string]string)
+	for _, name := range wantedNames {
+		state := wanted[name]
+		current, ok := states[name]
+		if !ok {
+			return fmt.Errorf("Rule '%s' does not run tasks on cluster '%s'", name, options.clusterName)
+		}
+
+		if current != state {
+			changes[name] = state
+		}
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("Nothing to change, the rules are already in the given state")
+		return nil
+	}
+
+	var names []string
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %s -> %s", name, states[name], changes[name]))
+	}
+
+	target, err := auditTarget(&options.awsOptions, options.clusterName)
+	if err != nil {
+		return err
+	}
+	plan.Target = target.Account
+
+	record := audit.Start("aws-ecs list-scheduled")
+	record.Target = target
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
+	for _, name := range names {
+		if changes[name] == eventbridge.RuleStateEnabled {
+			_, err = client.EnableRule(&eventbridge.EnableRuleInput{Name: aws.String(name)})
+			if err != nil {
+				return fmt.Errorf("Unable to enable rule %s: %v", name, err)
+			}
+			record.Add("enabled", 1)
+		} else {
+			_, err = client.DisableRule(&eventbridge.DisableRuleInput{Name: aws.String(name)})
+			if err != nil {
+				return fmt.Errorf("Unable to disable rule %s: %v", name, err)
+			}
+			record.Add("disabled", 1)
+		}
+
+		fmt.Printf("Rule %s is now %s\n", name, changes[name])
+	}
+
+	return nil
+}
+
+// ListScheduledCommand returns the `aws-ecs list-scheduled` command, which lists
+// the scheduled tasks defined as EventBridge rules targeting the cluster.
+func ListScheduledCommand() *cobra.Command {
+	var options scheduledOptions
+
+	cmd := &cobra.Command{
+		Use:   "list-scheduled <cluster>",
+		Short: "List the EventBridge rules running tasks on an ECS cluster, and enable or disable them",
+		Example: "  sysadmin-sk aws-ecs list-scheduled prod\n" +
+			"  sysadmin-sk aws-ecs list-scheduled prod --disable nightly-report --enable weekly-cleanup",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("Invalid number of arguments for aws-ecs list-scheduled command. Use --help for details")
+			}
+
+			if err := options.output.Validate(); err != nil {
+				return err
+			}
+
+			options.clusterName = args[0]
+			return listScheduledTasks(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringSliceVarP(&options.enable, "enable", "", nil, "Enable the given rules")
+	cmd.PersistentFlags().StringSliceVarP(&options.disable, "disable", "", nil, "Disable the given rules")
+	options.output.AddFlags(cmd.PersistentFlags())
+	options.guard.AddFlags(cmd.PersistentFlags())
+	return cmd
+}
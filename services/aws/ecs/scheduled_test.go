@@ -0,0 +1,65 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWantedRuleStates(t *testing.T) {
+	tests := []struct {
+		name    string
+		enable  []string
+		disable []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "nothing", want: map[string]string{}},
+		{
+			name:    "enable and disable",
+			enable:  []string{"weekly-cleanup"},
+			disable: []string{"nightly-report"},
+			want:    map[string]string{"weekly-cleanup": "ENABLED", "nightly-report": "DISABLED"},
+		},
+		{
+			name:    "given twice with the same flag",
+			enable:  []string{"nightly-report", "nightly-report"},
+			disable: []string{"weekly-cleanup", "weekly-cleanup"},
+			want:    map[string]string{"nightly-report": "ENABLED", "weekly-cleanup": "DISABLED"},
+		},
+		{
+			name:    "enabled and disabled",
+			enable:  []string{"nightly-report", "weekly-cleanup"},
+			disable: []string{"weekly-cleanup"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := wantedRuleStates(test.enable, test.disable)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("wantedRuleStates() error = %v, want error %v", err, test.wantErr)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wantedRuleStates() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
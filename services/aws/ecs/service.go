@@ -0,0 +1,181 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+)
+
+// describeService returns the service with the given name, on the given cluster
+func describeService(client *ecs.ECS, cluster string, service string) (*ecs.Service, error) {
+	description, err := client.DescribeServices(&ecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []*string{aws.String(service)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, failure := range description.Failures {
+		return nil, fmt.Errorf("Unable to find service '%s' on cluster '%s': %s",
+			service, cluster, aws.StringValue(failure.Reason))
+	}
+
+	if len(description.Services) == 0 {
+		return nil, fmt.Errorf("Unable to find service '%s' on cluster '%s'", service, cluster)
+	}
+
+	return description.Services[0], nil
+}
+
+// describeTasks returns the tasks with the given ARNs, in chunks of 100 which is
+// the most DescribeTasks accepts at a time.
+func describeTasks(client *ecs.ECS, cluster string, arns []*string) ([]*ecs.Task, error) {
+	var tasks []*ecs.Task
+
+	for i := 0; i < len(arns); i += 100 {
+		upperBound := i + 100
+		if upperBound > len(arns) {
+			upperBound = len(arns)
+		}
+
+		description, err := client.DescribeTasks(&ecs.DescribeTasksInput{
+			Cluster: aws.String(cluster),
+			Tasks:   arns[i:upperBound],
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		tasks = append(tasks, description.Tasks...)
+	}
+
+	return tasks, nil
+}
+
+// selectServices returns the services the bulk commands act on: the ones given by
+// name, or every service of the cluster matching the filter (all of them when the
+// filter is empty). One of them must be given, so a whole cluster is never
+// changed by mistake.
+func selectServices(options *awssession.Options, cluster string, names []string, filter serviceFilter, all bool) ([]*ecs.Service, error) {
+	client, err := ecsClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) > 0 && len(filter) > 0 {
+		return nil, errors.New("Give the services by name or select them with --filter, not both")
+	}
+
+	if len(names) > 0 {
+		var services []*ecs.Service
+		for _, name := range names {
+			service, err := describeService(client, cluster, name)
+			if err != nil {
+				return nil, err
+			}
+
+			services = append(services, service)
+		}
+
+		return services, nil
+	}
+
+	if len(filter) == 0 && !all {
+		return nil, errors.New("Give the services by name, or select them with --filter or --all")
+	}
+
+	listOptions := &listOptions{serviceFilter: filter, awsOptions: *options}
+	items, err := listClusterServices(listOptions, &clusterLocation{cluster: cluster})
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*ecs.Service
+	for _, item := range items {
+		services = append(services, item.Service)
+	}
+
+	return services, nil
+}
+
+// describeTaskDefinition returns the task definition, by ARN or family:revision,
+// along with its tags.
+func describeTaskDefinition(client *ecs.ECS, taskDefinition string) (*ecs.TaskDefinition, []*ecs.Tag, error) {
+	description, err := client.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(taskDefinition),
+		Include:        []*string{aws.String(ecs.TaskDefinitionFieldTags)},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return description.TaskDefinition, description.Tags, nil
+}
+
+// registerInput returns the input to register a new revision of the given task
+// definition, as is, so callers only change what they need.
+func registerInput(taskDefinition *ecs.TaskDefinition, tags []*ecs.Tag) *ecs.RegisterTaskDefinitionInput {
+	input := &ecs.RegisterTaskDefinitionInput{
+		ContainerDefinitions:    taskDefinition.ContainerDefinitions,
+		Cpu:                     taskDefinition.Cpu,
+		EphemeralStorage:        taskDefinition.EphemeralStorage,
+		ExecutionRoleArn:        taskDefinition.ExecutionRoleArn,
+		Family:                  taskDefinition.Family,
+		InferenceAccelerators:   taskDefinition.InferenceAccelerators,
+		IpcMode:                 taskDefinition.IpcMode,
+		Memory:                  taskDefinition.Memory,
+		NetworkMode:             taskDefinition.NetworkMode,
+		PidMode:                 taskDefinition.PidMode,
+		PlacementConstraints:    taskDefinition.PlacementConstraints,
+		ProxyConfiguration:      taskDefinition.ProxyConfiguration,
+		RequiresCompatibilities: taskDefinition.RequiresCompatibilities,
+		RuntimePlatform:         taskDefinition.RuntimePlatform,
+		TaskRoleArn:             taskDefinition.TaskRoleArn,
+		Volumes:                 taskDefinition.Volumes,
+	}
+
+	// an empty list of tags is rejected by the API
+	if len(tags) > 0 {
+		input.Tags = tags
+	}
+
+	return input
+}
+
+// auditTarget returns where the ECS changes happen, along with the AWS account ID
+// which must be typed to confirm changes on protected environments.
+func auditTarget(options *awssession.Options, cluster string) (audit.Target, error) {
+	accountID, err := awssession.AccountID(options)
+	if err != nil {
+		return audit.Target{}, err
+	}
+
+	region, err := awssession.Region(options)
+	if err != nil {
+		return audit.Target{}, err
+	}
+
+	return audit.Target{Account: accountID, Region: region, Cluster: cluster}, nil
+}
@@ -0,0 +1,557 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/output"
+)
+
+// the annotation keeping track of the task definition a manifest was generated from
+const taskDefinitionAnnotation = "sysadmin-sk/ecs-task-definition"
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// toK8sOptions defines the options used on the `aws-ecs to-k8s` command
+type toK8sOptions struct {
+
+	// cluster of the service to translate
+	clusterName string `type:"string" required:"true"`
+
+	// service to translate
+	serviceName string `type:"string" required:"true"`
+
+	// namespace of the generated objects, none by default
+	namespace string `type:"string" required:"false"`
+
+	// file to write the manifest to, the standard output by default
+	file string `type:"string" required:"false"`
+
+	// Define how to connect and authenticate against AWS
+	awsOptions awssession.Options `type:"awssession.Options" required:"false"`
+}
+
+// k8sTranslation holds the objects translated from a service and its task
+// definition, along with the warnings about what could not be translated.
+type k8sTranslation struct {
+	service        *ecs.Service
+	taskDefinition *ecs.TaskDefinition
+	namespace      string
+
+	objects  []interface{}
+	secrets  []string
+	warnings []string
+}
+
+// warn records a field which could not be translated
+func (t *k8sTranslation) warn(format string, args ...interface{}) {
+	t.warnings = append(t.warnings, fmt.Sprintf(format, args...))
+}
+
+// translateService writes the kubernetes manifest of the service
+func translateService(options *toK8sOptions) error {
+	client, err := ecsClient(&options.awsOptions)
+	if err != nil {
+		return err
+	}
+
+	service, err := describeService(client, options.clusterName, options.serviceName)
+	if err != nil {
+		return err
+	}
+
+	taskDefinition, _, err := describeTaskDefinition(client, aws.StringValue(service.TaskDefinition))
+	if err != nil {
+		return err
+	}
+
+	translation := &k8sTranslation{service: service, taskDefinition: taskDefinition, namespace: options.namespace}
+	translation.translate()
+
+	manifest, err := translation.manifest()
+	if err != nil {
+		return err
+	}
+
+	for _, warning := range translation.warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+
+	if options.file == "" {
+		_, err = os.Stdout.Write(manifest)
+		return err
+	}
+
+	return ioutil.WriteFile(options.file, manifest, 0644)
+}
+
+// translate builds the Deployment, the ConfigMaps holding the environment and,
+// when the containers expose ports, the Service.
+func (t *k8sTranslation) translate() {
+	name := k8sName(aws.StringValue(t.service.ServiceName))
+	labels := map[string]string{"app": name}
+
+	var configMaps []interface{}
+	podSpec := corev1.PodSpec{}
+
+	for _, definition := range t.taskDefinition.ContainerDefinitions {
+		container := t.translateContainer(name, definition)
+
+		if len(definition.Environment) > 0 {
+			configMap := t.environmentConfigMap(name+"-"+container.Name, definition.Environment)
+			configMaps = append(configMaps, configMap)
+			container.EnvFrom = []corev1.EnvFromSource{{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+				},
+			}}
+		}
+
+		if definition.StopTimeout != nil {
+			grace := aws.Int64Value(definition.StopTimeout)
+			if podSpec.TerminationGracePeriodSeconds == nil || *podSpec.TerminationGracePeriodSeconds < grace {
+				podSpec.TerminationGracePeriodSeconds = aws.Int64(grace)
+			}
+		}
+
+		podSpec.Containers = append(podSpec.Containers, container)
+	}
+
+	t.translateTaskResources(podSpec.Containers)
+	t.warnTaskFields()
+
+	replicas := int32(aws.Int64Value(t.service.DesiredCount))
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: t.objectMeta(name, labels),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Strategy: t.deploymentStrategy(),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+	deployment.Annotations = map[string]string{
+		taskDefinitionAnnotation: taskDefinitionName(t.taskDefinition.TaskDefinitionArn),
+	}
+
+	t.objects = append(t.objects, configMaps...)
+	t.objects = append(t.objects, deployment)
+
+	if service := t.translatePorts(name, labels, podSpec.Containers); service != nil {
+		t.objects = append(t.objects, service)
+	}
+
+	if len(t.secrets) > 0 {
+		t.warn("the secret %s is not generated, create it with the keys: %s", name, strings.Join(t.secrets, ", "))
+	}
+}
+
+// translateContainer translates a container definition, except its environment
+func (t *k8sTranslation) translateContainer(secretName string, definition *ecs.ContainerDefinition) corev1.Container {
+	container := corev1.Container{
+		Name:       k8sName(aws.StringValue(definition.Name)),
+		Image:      aws.StringValue(definition.Image),
+		Command:    aws.StringValueSlice(definition.EntryPoint),
+		Args:       aws.StringValueSlice(definition.Command),
+		WorkingDir: aws.StringValue(definition.WorkingDirectory),
+	}
+
+	for _, secret := range definition.Secrets {
+		key := aws.StringValue(secret.Name)
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name: key,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+					Key:                  key,
+				},
+			},
+		})
+		t.secrets = append(t.secrets, fmt.Sprintf("%s (from %s)", key, aws.StringValue(secret.ValueFrom)))
+	}
+
+	for _, mapping := range definition.PortMappings {
+		port := corev1.ContainerPort{
+			ContainerPort: int32(aws.Int64Value(mapping.ContainerPort)),
+			Protocol:      corev1.Protocol(strings.ToUpper(aws.StringValue(mapping.Protocol))),
+		}
+		if port.Protocol == "" {
+			port.Protocol = corev1.ProtocolTCP
+		}
+
+		hostPort := aws.Int64Value(mapping.HostPort)
+		if hostPort != 0 && hostPort != aws.Int64Value(mapping.ContainerPort) {
+			t.warn("%s: the host port %d is not translated, the container port %d is exposed by the Service",
+				container.Name, hostPort, port.ContainerPort)
+		}
+
+		container.Ports = append(container.Ports, port)
+	}
+
+	container.Resources = containerResources(definition)
+	container.SecurityContext = t.securityContext(container.Name, definition)
+
+	if probe := healthCheckProbe(definition.HealthCheck); probe != nil {
+		container.LivenessProbe = probe
+		container.ReadinessProbe = probe.DeepCopy()
+	}
+
+	t.warnContainerFields(container.Name, definition)
+	return container
+}
+
+// environmentConfigMap returns the ConfigMap holding the environment of a container
+func (t *k8sTranslation) environmentConfigMap(name string, environment []*ecs.KeyValuePair) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: t.objectMeta(name, nil),
+		Data:       make(map[string]string),
+	}
+
+	for _, variable := range environment {
+		configMap.Data[aws.StringValue(variable.Name)] = aws.StringValue(variable.Value)
+	}
+
+	return configMap
+}
+
+// containerResources translates the CPU units (1024 per vCPU) to requests and
+// the memory hard and soft limits to the memory limits and requests.
+func containerResources(definition *ecs.ContainerDefinition) corev1.ResourceRequirements {
+	resources := corev1.ResourceRequirements{}
+
+	if cpu := aws.Int64Value(definition.Cpu); cpu > 0 {
+		resources.Requests = corev1.ResourceList{
+			corev1.ResourceCPU: *resource.NewMilliQuantity(cpu*1000/1024, resource.DecimalSI),
+		}
+	}
+
+	if memory := aws.Int64Value(definition.Memory); memory > 0 {
+		resources.Limits = corev1.ResourceList{corev1.ResourceMemory: mebibytes(memory)}
+	}
+
+	if reservation := aws.Int64Value(definition.MemoryReservation); reservation > 0 {
+		if resources.Requests == nil {
+			resources.Requests = corev1.ResourceList{}
+		}
+		resources.Requests[corev1.ResourceMemory] = mebibytes(reservation)
+	}
+
+	return resources
+}
+
+// translateTaskResources uses the task CPU and memory (e.g: on Fargate) for the
+// containers without their own, when there's a single container to give them to.
+func (t *k8sTranslation) translateTaskResources(containers []corev1.Container) {
+	taskCPU, cpuErr := strconv.ParseInt(aws.StringValue(t.taskDefinition.Cpu), 10, 64)
+	taskMemory, memoryErr := strconv.ParseInt(aws.StringValue(t.taskDefinition.Memory), 10, 64)
+	if cpuErr != nil && memoryErr != nil {
+		return
+	}
+
+	if len(containers) != 1 {
+		t.warn("the task CPU and memory are not translated, set the resources of each container")
+		return
+	}
+
+	resources := &containers[0].Resources
+	if cpuErr == nil {
+		if _, ok := resources.Requests[corev1.ResourceCPU]; !ok {
+			if resources.Requests == nil {
+				resources.Requests = corev1.ResourceList{}
+			}
+			resources.Requests[corev1.ResourceCPU] = *resource.NewMilliQuantity(taskCPU*1000/1024, resource.DecimalSI)
+		}
+	}
+
+	if memoryErr == nil {
+		if _, ok := resources.Limits[corev1.ResourceMemory]; !ok {
+			if resources.Limits == nil {
+				resources.Limits = corev1.ResourceList{}
+			}
+			resources.Limits[corev1.ResourceMemory] = mebibytes(taskMemory)
+		}
+	}
+}
+
+// securityContext translates the privileged, read-only root file system and
+// numeric user settings of the container.
+func (t *k8sTranslation) securityContext(name string, definition *ecs.ContainerDefinition) *corev1.SecurityContext {
+	context := &corev1.SecurityContext{
+		Privileged:             definition.Privileged,
+		ReadOnlyRootFilesystem: definition.ReadonlyRootFilesystem,
+	}
+
+	if user := aws.StringValue(definition.User); user != "" {
+		parts := strings.SplitN(user, ":", 2)
+		uid, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			t.warn("%s: the user %q is not numeric, set runAsUser to its UID", name, user)
+		} else {
+			context.RunAsUser = aws.Int64(uid)
+		}
+
+		if len(parts) == 2 {
+			if gid, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+				context.RunAsGroup = aws.Int64(gid)
+			}
+		}
+	}
+
+	if context.Privileged == nil && context.ReadOnlyRootFilesystem == nil && context.RunAsUser == nil {
+		return nil
+	}
+
+	return context
+}
+
+// healthCheckProbe translates the container health check to a probe
+func healthCheckProbe(check *ecs.HealthCheck) *corev1.Probe {
+	if check == nil || len(check.Command) == 0 {
+		return nil
+	}
+
+	command := aws.StringValueSlice(check.Command)
+	switch command[0] {
+	case "CMD-SHELL":
+		command = []string{"sh", "-c", strings.Join(command[1:], " ")}
+	case "CMD":
+		command = command[1:]
+	}
+
+	probe := &corev1.Probe{
+		Handler:             corev1.Handler{Exec: &corev1.ExecAction{Command: command}},
+		InitialDelaySeconds: int32(aws.Int64Value(check.StartPeriod)),
+		PeriodSeconds:       int32(aws.Int64Value(check.Interval)),
+		TimeoutSeconds:      int32(aws.Int64Value(check.Timeout)),
+		FailureThreshold:    int32(aws.Int64Value(check.Retries)),
+	}
+
+	return probe
+}
+
+// deploymentStrategy translates the minimum healthy and maximum percents to the
+// rolling update maximum unavailable and surge.
+func (t *k8sTranslation) deploymentStrategy() appsv1.DeploymentStrategy {
+	configuration := t.service.DeploymentConfiguration
+	if configuration == nil || configuration.MinimumHealthyPercent == nil || configuration.MaximumPercent == nil {
+		return appsv1.DeploymentStrategy{}
+	}
+
+	maxUnavailable := intstr.FromString(fmt.Sprintf("%d%%", 100-aws.Int64Value(configuration.MinimumHealthyPercent)))
+	maxSurge := intstr.FromString(fmt.Sprintf("%d%%", aws.Int64Value(configuration.MaximumPercent)-100))
+
+	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxUnavailable: &maxUnavailable,
+			MaxSurge:       &maxSurge,
+		},
+	}
+}
+
+// translatePorts returns the Service exposing the container ports, nil when
+// the containers have none.
+func (t *k8sTranslation) translatePorts(name string, labels map[string]string, containers []corev1.Container) *corev1.Service {
+	service := &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: t.objectMeta(name, labels),
+		Spec:       corev1.ServiceSpec{Selector: labels},
+	}
+
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+				Name:       fmt.Sprintf("%s-%d", strings.ToLower(string(port.Protocol)), port.ContainerPort),
+				Protocol:   port.Protocol,
+				Port:       port.ContainerPort,
+				TargetPort: intstr.FromInt(int(port.ContainerPort)),
+			})
+		}
+	}
+
+	if len(t.service.LoadBalancers) > 0 {
+		t.warn("the load balancers are not translated, expose the Service with an Ingress or a LoadBalancer Service")
+	}
+
+	if len(service.Spec.Ports) == 0 {
+		return nil
+	}
+
+	return service
+}
+
+// warnContainerFields warns about the container fields without a translation
+func (t *k8sTranslation) warnContainerFields(name string, definition *ecs.ContainerDefinition) {
+	unmapped := map[string]bool{
+		"links":                 len(definition.Links) > 0,
+		"volumesFrom":           len(definition.VolumesFrom) > 0,
+		"mountPoints":           len(definition.MountPoints) > 0,
+		"dependsOn":             len(definition.DependsOn) > 0,
+		"dockerLabels":          len(definition.DockerLabels) > 0,
+		"ulimits":               len(definition.Ulimits) > 0,
+		"dnsServers":            len(definition.DnsServers) > 0,
+		"extraHosts":            len(definition.ExtraHosts) > 0,
+		"environmentFiles":      len(definition.EnvironmentFiles) > 0,
+		"linuxParameters":       definition.LinuxParameters != nil,
+		"firelensConfiguration": definition.FirelensConfiguration != nil,
+		"repositoryCredentials": definition.RepositoryCredentials != nil,
+	}
+
+	var fields []string
+	for field, set := range unmapped {
+		if set {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	if len(fields) > 0 {
+		t.warn("%s: not translated: %s", name, strings.Join(fields, ", "))
+	}
+
+	if definition.LogConfiguration != nil {
+		t.warn("%s: the %s log configuration is not translated, the logs are written to the container output",
+			name, aws.StringValue(definition.LogConfiguration.LogDriver))
+	}
+
+	if definition.Essential != nil && !aws.BoolValue(definition.Essential) {
+		t.warn("%s: is not essential, on kubernetes every container of the pod is restarted when it exits", name)
+	}
+}
+
+// warnTaskFields warns about the task definition and service fields without a translation
+func (t *k8sTranslation) warnTaskFields() {
+	if t.taskDefinition.TaskRoleArn != nil {
+		t.warn("the task role %s is not translated, use a ServiceAccount (e.g: IAM roles for service accounts)",
+			aws.StringValue(t.taskDefinition.TaskRoleArn))
+	}
+
+	if len(t.taskDefinition.Volumes) > 0 {
+		t.warn("the task volumes are not translated, define them as volumes of the pod")
+	}
+
+	if len(t.taskDefinition.PlacementConstraints) > 0 || len(t.service.PlacementConstraints) > 0 ||
+		len(t.service.PlacementStrategy) > 0 {
+		t.warn("the placement constraints and strategy are not translated, use node affinity or topology spread constraints")
+	}
+
+	if len(t.service.ServiceRegistries) > 0 {
+		t.warn("the service discovery registries are not translated, the Service has a cluster DNS name")
+	}
+}
+
+// objectMeta returns the metadata of a generated object
+func (t *k8sTranslation) objectMeta(name string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: t.namespace, Labels: labels}
+}
+
+// manifest returns the objects as a multi-document YAML, without the empty
+// fields (e.g: creationTimestamp, status), as consumed by `k8s apply-manifest`.
+func (t *k8sTranslation) manifest() ([]byte, error) {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "# Generated by sysadmin-sk aws-ecs to-k8s from the service %s (%s)\n",
+		aws.StringValue(t.service.ServiceName), taskDefinitionName(t.taskDefinition.TaskDefinitionArn))
+
+	for i, object := range t.objects {
+		document, err := output.Prune(object)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := yaml.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			buffer.WriteString("---\n")
+		}
+		buffer.Write(content)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// k8sName returns the name as a valid kubernetes object name (RFC 1123 label)
+func k8sName(name string) string {
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-")
+	if len(name) > 63 {
+		name = strings.Trim(name[:63], "-")
+	}
+
+	return name
+}
+
+func mebibytes(value int64) resource.Quantity {
+	return *resource.NewQuantity(value*1024*1024, resource.BinarySI)
+}
+
+// ToK8sCommand returns the `aws-ecs to-k8s` command, which translates a service
+// and its task definition to kubernetes objects.
+func ToK8sCommand() *cobra.Command {
+	var options toK8sOptions
+
+	cmd := &cobra.Command{
+		Use:   "to-k8s <cluster> <service>",
+		Short: "Translate an ECS service and its task definition to a kubernetes manifest",
+		Long: "Translate an ECS service and its task definition to a kubernetes Deployment, Service and ConfigMaps,\n" +
+			"to be applied with 'k8s apply-manifest'. The secrets are referenced from a Secret named after the\n" +
+			"service, which is not generated, and the fields without a translation are reported as warnings.",
+		Example: "  sysadmin-sk aws-ecs to-k8s prod api --namespace api --file api.yaml\n" +
+			"  sysadmin-sk k8s apply-manifest --manifest-path api.yaml",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("Invalid number of arguments for aws-ecs to-k8s command. Use --help for details")
+			}
+
+			options.clusterName = args[0]
+			options.serviceName = args[1]
+			return translateService(&options)
+		},
+	}
+
+	options.awsOptions.AddFlags(cmd.PersistentFlags())
+	cmd.PersistentFlags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of the generated objects")
+	cmd.PersistentFlags().StringVarP(&options.file, "file", "f", "", "Write the manifest to the file rather than the standard output")
+	return cmd
+}
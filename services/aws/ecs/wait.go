@@ -0,0 +1,150 @@
+/*
+ * This file is part of the Sysadmin Sidekick Toolkit (Sysadmin-SK) (https://github.com/raffs/sysadmin-sk).
+ * Copyright (c) 2019 Rafael Oliveira Silva
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, version 3.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the GNU
+ * General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+package ecs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/spf13/pflag"
+)
+
+// how often the service is described while waiting for a deployment
+const waitInterval = 10 * time.Second
+
+// waitOptions defines how the commands updating a service wait for the deployment
+type waitOptions struct {
+
+	// return as soon as the service is updated, without following the deployment
+	noWait bool `type:"bool" required:"false"`
+
+	// how long to wait for the deployment to complete
+	timeout time.Duration `type:"duration" required:"false"`
+}
+
+// addFlags registers the --no-wait and --timeout flags on the given flag set
+func (o *waitOptions) addFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(&o.noWait, "no-wait", "", false, "Do not wait for the deployment to complete")
+	flags.DurationVarP(&o.timeout, "timeout", "", 15*time.Minute, "How long to wait for the deployment to complete")
+}
+
+// primaryDeployment returns the deployment the service is rolling out
+func primaryDeployment(service *ecs.Service) *ecs.Deployment {
+	for _, deployment := range service.Deployments {
+		if aws.StringValue(deployment.Status) == "PRIMARY" {
+			return deployment
+		}
+	}
+
+	return nil
+}
+
+// waitForDeployment follows the deployment, printing the service events as they
+// happen, until it completes, fails or the timeout is reached. The service events
+// older than since are not printed.
+func waitForDeployment(client *ecs.ECS, service *ecs.Service, deploymentID string, since time.Time, options *waitOptions) error {
+	cluster := aws.StringValue(service.ClusterArn)
+	name := aws.StringValue(service.ServiceName)
+	deadline := time.Now().Add(options.timeout)
+
+	var lastStatus string
+	var failedTasks int64
+
+	fmt.Printf("Waiting for deployment %s of service '%s' to complete\n", deploymentID, name)
+
+	for {
+		service, err := describeService(client, cluster, name)
+		if err != nil {
+			return err
+		}
+
+		since = printServiceEvents(service, since)
+
+		var deployment *ecs.Deployment
+		for _, d := range service.Deployments {
+			if aws.StringValue(d.Id) == deploymentID {
+				deployment = d
+			}
+		}
+
+		if deployment == nil {
+			return fmt.Errorf("Deployment %s is no longer part of service '%s', it has been replaced or rolled back", deploymentID, name)
+		}
+
+		if failed := aws.Int64Value(deployment.FailedTasks); failed > failedTasks {
+			fmt.Fprintf(os.Stderr, "Warning: %d task(s) failed to start\n", failed-failedTasks)
+			failedTasks = failed
+		}
+
+		status := fmt.Sprintf("running %d/%d, pending %d, failed %d",
+			aws.Int64Value(deployment.RunningCount), aws.Int64Value(deployment.DesiredCount),
+			aws.Int64Value(deployment.PendingCount), failedTasks)
+		if state := aws.StringValue(deployment.RolloutState); state != "" {
+			status += " (" + state + ")"
+		}
+
+		if status != lastStatus {
+			fmt.Printf("%s  %s\n", time.Now().Format("15:04:05"), status)
+			lastStatus = status
+		}
+
+		switch aws.StringValue(deployment.RolloutState) {
+		case ecs.DeploymentRolloutStateCompleted:
+			fmt.Printf("Deployment %s completed\n", deploymentID)
+			return nil
+
+		case ecs.DeploymentRolloutStateFailed:
+			return fmt.Errorf("Deployment %s failed: %s", deploymentID, aws.StringValue(deployment.RolloutStateReason))
+
+		case "":
+			// services not using the ECS deployment controller have no rollout
+			// state, they are stable once the older deployments are gone.
+			if len(service.Deployments) == 1 &&
+				aws.Int64Value(deployment.RunningCount) == aws.Int64Value(deployment.DesiredCount) {
+				fmt.Printf("Deployment %s completed\n", deploymentID)
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("Timed out waiting for deployment " + deploymentID + " to complete")
+		}
+
+		time.Sleep(waitInterval)
+	}
+}
+
+// printServiceEvents prints, oldest first, the service events newer than since
+// and returns the time of the newest event printed.
+func printServiceEvents(service *ecs.Service, since time.Time) time.Time {
+	for i := len(service.Events) - 1; i >= 0; i-- {
+		event := service.Events[i]
+		createdAt := aws.TimeValue(event.CreatedAt)
+		if !createdAt.After(since) {
+			continue
+		}
+
+		fmt.Printf("%s  %s\n", createdAt.Local().Format("15:04:05"), aws.StringValue(event.Message))
+		since = createdAt
+	}
+
+	return since
+}
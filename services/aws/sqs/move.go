@@ -22,9 +22,12 @@ import (
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/spf13/cobra"
+
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/awssession"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
 )
 
 // MoveMessagesOptions defines all the configuration options for `aws sqs move` command
@@ -54,16 +57,12 @@ type moveMessageOptions struct {
 	// Whether to delete a message from the source queue. default: false
 	KeepMessageOnSourceQueue bool `type:"string" required:"false"`
 
-	// Define the AWS Region to connect to. This essentially will be converted
-	// to an URL with the region name.
-	AwsRegion string `type:"string" required:"false"`
-
-	// In case you want to overwrite the underlying endpoint for testing or
-	// other kind black Sorcery.
-	AwsEndpoint string `type:"string" required:"false"`
+	// Define how to connect and authenticate against AWS: region, profile, the
+	// endpoint (for testing or other kind black Sorcery) and role to assume.
+	AwsOptions awssession.Options `type:"awssession.Options" required:"false"`
 
-	// Define the AWS profile
-	AwsProfile string `type:"string" required:"false"`
+	// Define the --dry-run and confirmation behaviour
+	Guard guard.Options `type:"guard.Options" required:"false"`
 
 	// Pointer to a ReceiptHandle
 	ReceiptHandlers map[string]string `type:"map[string]*string" required:"false"`
@@ -103,19 +102,9 @@ func getQueueAttributes(client *sqs.SQS, queueURL *string) *sqs.GetQueueAttribut
 
 // sqsClient create and returns a sqs client object
 func sqsClient(options *moveMessageOptions) (*sqs.SQS, error) {
-	sessionOpts := session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-		// aws configuration
-		Config: aws.Config{
-			Region:   aws.String(options.AwsRegion),
-			Endpoint: aws.String(options.AwsEndpoint),
-		},
-	}
-
-	session, err := session.NewSessionWithOptions(sessionOpts)
+	session, err := awssession.New(&options.AwsOptions)
 	if err != nil {
-		fmt.Println("Unable to create new session with AWS with error: ", err.Error())
-		return nil, errors.New("Unable to initialize AWS session")
+		return nil, err
 	}
 
 	return sqs.New(session), nil
@@ -200,7 +189,7 @@ func deleteBatchMessages(client *sqs.SQS,
 // MoveMessages Given a moveMessageOptions struct with the proper source and target queue
 // along with additional options for fine control migration. And sync and/or move
 // all or the partially (see filters options) from source queue to target queue.
-func MoveMessages(options *moveMessageOptions) error {
+func MoveMessages(options *moveMessageOptions) (err error) {
 	client, err := sqsClient(options)
 	if err != nil {
 		return err
@@ -239,6 +228,39 @@ func MoveMessages(options *moveMessageOptions) error {
 	fmt.Printf("Source Queue '%s' contains %d of messages\n", options.SourceQueueName, sourceNumMessages)
 	fmt.Printf("Target Queue '%s' contains %d of messages\n", options.TargetQueueName, targetNumMessages)
 	fmt.Printf("Number of the messages to be processed at a time: %d\n", options.BatchSize)
+
+	accountID, err := awssession.AccountID(&options.AwsOptions)
+	if err != nil {
+		return err
+	}
+
+	region, err := awssession.Region(&options.AwsOptions)
+	if err != nil {
+		return err
+	}
+
+	plan := &guard.Plan{
+		Action: "Move messages between SQS queues",
+		Target: accountID,
+		Changes: []string{
+			fmt.Sprintf("send ~%d messages from '%s' to '%s'", sourceNumMessages, options.SourceQueueName, options.TargetQueueName),
+		},
+	}
+
+	if !options.KeepMessageOnSourceQueue {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("delete the sent messages from '%s'", options.SourceQueueName))
+	}
+
+	record := audit.Start("aws-sqs move")
+	record.Target = audit.Target{Account: accountID, Region: region}
+	record.DryRun = options.Guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	proceed, err := guard.Confirm(&options.Guard, plan)
+	if err != nil || !proceed {
+		return err
+	}
+
 	fmt.Printf("\nStarting migrating, these could take a while ")
 
 	messageInOptions := &sqs.ReceiveMessageInput{
@@ -268,6 +290,9 @@ func MoveMessages(options *moveMessageOptions) error {
 			return err
 		}
 
+		record.Add("sent", int64(len(sendResponse.Successful)))
+		record.Add("failed", int64(len(sendResponse.Failed)))
+
 		// Delete successfully migrated message from source queue
 		if !options.KeepMessageOnSourceQueue && len(sendResponse.Successful) > 0 {
 
@@ -277,10 +302,12 @@ func MoveMessages(options *moveMessageOptions) error {
 			}
 
 			// delete messages
-			_, err := deleteBatchMessages(client, options, sendResponse)
+			deletedMsgs, err := deleteBatchMessages(client, options, sendResponse)
 			if err != nil {
 				return err
 			}
+
+			record.Add("deleted", deletedMsgs)
 		}
 	}
 
@@ -338,9 +365,8 @@ func MoveCommand() *cobra.Command {
 	cmd.PersistentFlags().Int64VarP(&options.WaitTimeSeconds, "wait-time-seconds", "w", 0, "Wait until receive the message")
 	cmd.PersistentFlags().Int64VarP(&options.VisibilityTimeout, "visibility-timeout", "t", 10, "Message the visibility")
 	cmd.PersistentFlags().BoolVarP(&options.KeepMessageOnSourceQueue, "keep-message-on-source-queue", "k", false, "Whether to keep the message from source queue")
-	cmd.PersistentFlags().StringVarP(&options.AwsRegion, "aws-region", "r", "", "define AWS region.")
-	cmd.PersistentFlags().StringVarP(&options.AwsProfile, "aws-profile", "p", "", "define AWS profile")
-	cmd.PersistentFlags().StringVarP(&options.AwsEndpoint, "aws-endpoint", "e", "", "Define the AWS API endpoint (usually for low-level and testing")
+	options.AwsOptions.AddFlags(cmd.PersistentFlags())
+	options.Guard.AddFlags(cmd.PersistentFlags())
 
 	return cmd
 }
@@ -3,48 +3,40 @@ package k8s
 import (
 	"bytes"
 	"context"
-	"flag"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
 	"io/ioutil"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/restmapper"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/dynamic"
+	"github.com/raffs/sysadmin-sk/pkg/audit"
+	"github.com/raffs/sysadmin-sk/pkg/guard"
 	"github.com/raffs/sysadmin-sk/utils"
 )
 
 type K8sOptions struct {
 	manifestPath string `type:"string" required:"true"`
+	namespace    string `type:"string" required:"false"`
+	kube         utils.KubeOptions
+	guard        guard.Options
 }
 
-func applyManifest(options *K8sOptions) error {
-	// Need to move this into client.go
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
+func applyManifest(options *K8sOptions) (err error) {
 	filestream, err := ioutil.ReadFile(options.manifestPath)
 	if err != nil {
 		fmt.Println(err.Error())
 		return err
 	}
 	fmt.Println(string(filestream))
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	config, err := utils.K8sConfig(&options.kube)
 	if err != nil {
-		fmt.Println(err.Error())
 		return err
 	}
 
@@ -60,30 +52,37 @@ func applyManifest(options *K8sOptions) error {
 		return err
 	}
 
+	gr, err := restmapper.GetAPIGroupResources(c.Discovery())
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(gr)
+
+	// decode every object before creating anything, so the whole plan can be
+	// confirmed and a broken manifest does not end up half applied.
+	var resources []*manifestResource
 	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(filestream), 100)
 	for {
 		var rawObj runtime.RawExtension
 		if err = decoder.Decode(&rawObj); err != nil {
-			fmt.Println("Decode ERROR: " + err.Error())
 			break
 		}
 
 		obj, gvk, err := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme).Decode(rawObj.Raw, nil, nil)
-		unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
 		if err != nil {
-			fmt.Println(err.Error())
+			fmt.Println("Decode ERROR: " + err.Error())
 			return err
 		}
 
-		unstructuredObj := &unstructured.Unstructured{Object: unstructuredMap}
-
-		gr, err := restmapper.GetAPIGroupResources(c.Discovery())
+		unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
 		if err != nil {
 			fmt.Println(err.Error())
 			return err
 		}
 
-		mapper := restmapper.NewDiscoveryRESTMapper(gr)
+		unstructuredObj := &unstructured.Unstructured{Object: unstructuredMap}
+
 		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 		if err != nil {
 			fmt.Println(err.Error())
@@ -93,26 +92,84 @@ func applyManifest(options *K8sOptions) error {
 		var dri dynamic.ResourceInterface
 		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
 			if unstructuredObj.GetNamespace() == "" {
-				unstructuredObj.SetNamespace("default")
+				unstructuredObj.SetNamespace(options.namespace)
 			}
 			dri = dd.Resource(mapping.Resource).Namespace(unstructuredObj.GetNamespace())
 		} else {
 			dri = dd.Resource(mapping.Resource)
 		}
 
-		if _, err := dri.Create(context.Background(), unstructuredObj, metav1.CreateOptions{}); err != nil {
+		resources = append(resources, &manifestResource{object: unstructuredObj, client: dri})
+	}
+	if err != io.EOF {
+		fmt.Println("Decode ERROR: " + err.Error())
+		return err
+	}
+
+	kubeContext, err := utils.K8sContext(&options.kube)
+	if err != nil {
+		return err
+	}
+
+	plan := &guard.Plan{
+		Action: "Apply manifest " + options.manifestPath,
+		Target: kubeContext,
+	}
+	for _, resource := range resources {
+		plan.Changes = append(plan.Changes, "create "+resource.String())
+	}
+
+	record := audit.Start("k8s apply-manifest")
+	record.Target = audit.Target{Context: kubeContext, Namespace: options.namespace}
+	record.DryRun = options.guard.DryRun
+	defer func() { record.Finish(err) }()
+
+	createOptions := metav1.CreateOptions{}
+	proceed, err := guard.Confirm(&options.guard, plan)
+	if err != nil {
+		return err
+	}
+
+	// on dry-run, still send the objects to the API server so they are validated
+	if !proceed {
+		createOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	for _, resource := range resources {
+		if _, err := resource.client.Create(context.Background(), resource.object, createOptions); err != nil {
 			fmt.Println(err.Error())
 			return err
 		}
+		if proceed {
+			record.Add("created", 1)
+		} else {
+			record.Add("validated", 1)
+		}
 	}
-	if err != io.EOF {
-		fmt.Println(err.Error())
-		return err
+
+	if !proceed {
+		fmt.Println("*** Validated manifest at : " + options.manifestPath + " (dry-run) ***")
+		return nil
 	}
+
 	fmt.Println("*** Applied manifest at : " + options.manifestPath + " ***")
 	return nil
 }
 
+// manifestResource is one object of the manifest, along with the client to create it
+type manifestResource struct {
+	object *unstructured.Unstructured
+	client dynamic.ResourceInterface
+}
+
+func (r *manifestResource) String() string {
+	name := r.object.GetKind() + "/" + r.object.GetName()
+	if r.object.GetNamespace() != "" {
+		name += " in namespace " + r.object.GetNamespace()
+	}
+	return name
+}
+
 func ApplyManifest() *cobra.Command {
 	var options K8sOptions
 
@@ -128,5 +185,8 @@ func ApplyManifest() *cobra.Command {
 		},
 	}
 	cmd.PersistentFlags().StringVarP(&options.manifestPath, "manifest-path", "p", "", "Path to the k8s manifest to apply")
+	cmd.PersistentFlags().StringVarP(&options.namespace, "namespace", "n", "default", "Namespace for the resources which do not define one")
+	options.kube.AddFlags(cmd.PersistentFlags())
+	options.guard.AddFlags(cmd.PersistentFlags())
 	return cmd
 }
\ No newline at end of file
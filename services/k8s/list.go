@@ -3,23 +3,166 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/raffs/sysadmin-sk/pkg/output"
 	"github.com/raffs/sysadmin-sk/utils"
 	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"strings"
 )
 
 type ListOptions struct {
 	kind 			string `type:"string" required:"true"`
 	namespace		string `type:"string" required:"true"`
+	kube			utils.KubeOptions
+	output			output.Options
+}
+
+// metaColumns are the namespace, name and age columns, common to every kind
+var metaColumns = []output.Column{
+	{Header: "Namespace", Value: func(obj interface{}) string {
+		return obj.(v1.Object).GetNamespace()
+	}},
+	{Header: "Name", Value: func(obj interface{}) string {
+		return obj.(v1.Object).GetName()
+	}},
+	{Header: "Age", Value: func(obj interface{}) string {
+		created := obj.(v1.Object).GetCreationTimestamp()
+		return output.Age(&created.Time)
+	}},
+}
+
+var deploymentColumns = append(metaColumns[:2:2],
+	output.Column{Header: "Ready", Value: func(obj interface{}) string {
+		res := obj.(*appsv1.Deployment)
+		return fmt.Sprintf("%d/%d", res.Status.ReadyReplicas, res.Status.Replicas)
+	}},
+	output.Column{Header: "Available", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*appsv1.Deployment).Status.AvailableReplicas)
+	}},
+	output.Column{Header: "Unavailable", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*appsv1.Deployment).Status.UnavailableReplicas)
+	}},
+	metaColumns[2],
+	output.Column{Header: "Images", Wide: true, Value: func(obj interface{}) string {
+		return containerImages(obj.(*appsv1.Deployment).Spec.Template.Spec.Containers)
+	}},
+)
+
+var daemonSetColumns = append(metaColumns[:2:2],
+	output.Column{Header: "Desired", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*appsv1.DaemonSet).Status.DesiredNumberScheduled)
+	}},
+	output.Column{Header: "Available", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*appsv1.DaemonSet).Status.NumberAvailable)
+	}},
+	output.Column{Header: "Unavailable", Value: func(obj interface{}) string {
+		return fmt.Sprint(obj.(*appsv1.DaemonSet).Status.NumberUnavailable)
+	}},
+	metaColumns[2],
+	output.Column{Header: "Images", Wide: true, Value: func(obj interface{}) string {
+		return containerImages(obj.(*appsv1.DaemonSet).Spec.Template.Spec.Containers)
+	}},
+)
+
+var statefulSetColumns = append(metaColumns[:2:2],
+	output.Column{Header: "Ready", Value: func(obj interface{}) string {
+		res := obj.(*appsv1.StatefulSet)
+		return fmt.Sprintf("%d/%d", res.Status.ReadyReplicas, res.Status.Replicas)
+	}},
+	metaColumns[2],
+	output.Column{Header: "Images", Wide: true, Value: func(obj interface{}) string {
+		return containerImages(obj.(*appsv1.StatefulSet).Spec.Template.Spec.Containers)
+	}},
+)
+
+var serviceColumns = append(metaColumns[:2:2],
+	output.Column{Header: "Type", Value: func(obj interface{}) string {
+		return string(obj.(*corev1.Service).Spec.Type)
+	}},
+	output.Column{Header: "Cluster-IP", Value: func(obj interface{}) string {
+		return obj.(*corev1.Service).Spec.ClusterIP
+	}},
+	output.Column{Header: "Ports", Value: func(obj interface{}) string {
+		var ports []string
+		for _, port := range obj.(*corev1.Service).Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		}
+		return output.Join(ports)
+	}},
+	metaColumns[2],
+	output.Column{Header: "Labels", Wide: true, Value: func(obj interface{}) string {
+		return labels(obj.(*corev1.Service).Labels)
+	}},
+)
+
+var podColumns = append(metaColumns[:2:2],
+	output.Column{Header: "Ready", Value: func(obj interface{}) string {
+		res := obj.(*corev1.Pod)
+		ready := 0
+		for _, status := range res.Status.ContainerStatuses {
+			if status.Ready {
+				ready++
+			}
+		}
+		return fmt.Sprintf("%d/%d", ready, len(res.Spec.Containers))
+	}},
+	output.Column{Header: "Status", Value: func(obj interface{}) string {
+		return string(obj.(*corev1.Pod).Status.Phase)
+	}},
+	output.Column{Header: "Restarts", Value: func(obj interface{}) string {
+		var restarts int32
+		for _, status := range obj.(*corev1.Pod).Status.ContainerStatuses {
+			restarts += status.RestartCount
+		}
+		return fmt.Sprint(restarts)
+	}},
+	metaColumns[2],
+	output.Column{Header: "IP", Wide: true, Value: func(obj interface{}) string {
+		return obj.(*corev1.Pod).Status.PodIP
+	}},
+	output.Column{Header: "Node", Wide: true, Value: func(obj interface{}) string {
+		return obj.(*corev1.Pod).Spec.NodeName
+	}},
+	output.Column{Header: "Labels", Wide: true, Value: func(obj interface{}) string {
+		return labels(obj.(*corev1.Pod).Labels)
+	}},
+)
+
+func containerImages(containers []corev1.Container) string {
+	var images []string
+	for _, container := range containers {
+		images = append(images, container.Image)
+	}
+	return output.Join(images)
+}
+
+func labels(values map[string]string) string {
+	var pairs []string
+	for key, value := range values {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return output.Join(pairs)
 }
 
 func listResource(options *ListOptions) error {
-	client, err := utils.K8sClient()
+	if err := options.output.Validate(); err != nil {
+		return err
+	}
+
+	client, err := utils.K8sClient(&options.kube)
 	if err != nil {
 		fmt.Println(err.Error())
 		return err
 	}
+
+	var items []interface{}
+	var columns []output.Column
 	switch strings.Title(options.kind) {
 	case "Deployment":
 		deps, err := client.AppsV1().Deployments(options.namespace).List(context.TODO(),v1.ListOptions{})
@@ -27,75 +170,65 @@ func listResource(options *ListOptions) error {
 			fmt.Println(err.Error())
 			return err
 		}
-		for _, res := range (*deps).Items {
-			fmt.Println("***********************************************************")
-			fmt.Printf("deployments-name=%v\n", res.Name)
-			fmt.Printf("deployments-status=%v\n", res.Status)
-			fmt.Printf("deployments-creationtime=%v\n", res.CreationTimestamp)
-			fmt.Printf("deployments-available-replicas=%v\n", res.Status.AvailableReplicas)
-			fmt.Printf("deployments-unavailable-replicas=%v\n", res.Status.UnavailableReplicas)
-			fmt.Printf("deployments-namespace=%v\n", res.Namespace)
+		for i := range deps.Items {
+			items = append(items, &deps.Items[i])
 		}
+		columns = deploymentColumns
 	case "Daemonset":
 		dems, err := client.AppsV1().DaemonSets(options.namespace).List(context.TODO(), v1.ListOptions{})
 		if err != nil {
 			fmt.Println(err.Error())
 			return err
 		}
-		for _, res := range (*dems).Items {
-			fmt.Println("***********************************************************")
-			fmt.Printf("daemonsets-name=%v\n", res.Name)
-			fmt.Printf("daemonset-status=%v\n", res.Status)
-			fmt.Printf("daemonset-creationtime=%v\n", res.CreationTimestamp)
-			fmt.Printf("daemonset-replicas-available=%v\n", res.Status.NumberAvailable)
-			fmt.Printf("daemonset-replicas-unavailable=%v\n", res.Status.NumberUnavailable)
-			fmt.Printf("deployments-namespace=%v\n", res.Namespace)
+		for i := range dems.Items {
+			items = append(items, &dems.Items[i])
 		}
+		columns = daemonSetColumns
 	case "StatefulSet":
 		ss, err := client.AppsV1().StatefulSets(options.namespace).List(context.TODO(), v1.ListOptions{})
 		if err != nil {
 			fmt.Println(err.Error())
 			return err
 		}
-		for _, res := range (*ss).Items {
-			fmt.Println("***********************************************************")
-			fmt.Printf("statefulsets-name=%v\n", res.Name)
-			fmt.Printf("statefulsets-status=%v\n", res.Status)
-			fmt.Printf("statefulset-creationtime=%v\n", res.CreationTimestamp)
-			fmt.Printf("statement-desired-replicas=%v\n", res.Status.Replicas)
-			fmt.Printf("daemonset-ready-replicas=%v\n", res.Status.ReadyReplicas)
-			fmt.Printf("deployments-namespace=%v\n", res.Namespace)
+		for i := range ss.Items {
+			items = append(items, &ss.Items[i])
 		}
+		columns = statefulSetColumns
 	case "Service":
 		srv, err := client.CoreV1().Services(options.namespace).List(context.TODO(), v1.ListOptions{})
 		if err != nil {
 			fmt.Println(err.Error())
 			return err
 		}
-		for _, res := range (*srv).Items {
-			fmt.Println("***********************************************************")
-			fmt.Printf("services-name=%v\n", res.Name)
-			fmt.Printf("services-status=%v\n", res.Status)
-			fmt.Printf("service-creationtime=%v\n", res.CreationTimestamp)
-			fmt.Printf("daemonset-labels=%v\n", res.Labels)
-			fmt.Printf("deployments-namespace=%v\n", res.Namespace)
+		for i := range srv.Items {
+			items = append(items, &srv.Items[i])
 		}
+		columns = serviceColumns
 	case "Pod":
 		p, err := client.CoreV1().Pods(options.namespace).List(context.TODO(), v1.ListOptions{})
 		if err != nil {
 			fmt.Println(err.Error())
 			return err
 		}
-		for _, res := range (*p).Items {
-			fmt.Println("***********************************************************")
-			fmt.Printf("pod-name=%v\n", res.Name)
-			fmt.Printf("pod-status=%v\n", res.Status)
-			fmt.Printf("pod-creationtime=%v\n", res.CreationTimestamp)
-			fmt.Printf("pod-labels=%v\n", res.Labels)
-			fmt.Printf("pod-namespace=%v\n", res.Namespace)
+		for i := range p.Items {
+			items = append(items, &p.Items[i])
+		}
+		columns = podColumns
+	default:
+		return nil
+	}
+
+	printer, err := output.NewPrinter(os.Stdout, &options.output, columns)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := printer.Print(item); err != nil {
+			return err
 		}
 	}
-	return nil
+	return printer.Flush()
 }
 
 func ListResources() *cobra.Command {
@@ -113,6 +246,8 @@ func ListResources() *cobra.Command {
 		},
 	}
 	cmd.PersistentFlags().StringVarP(&options.kind, "kind", "t", "", "List ResourceType")
-	cmd.PersistentFlags().StringVarP(&options.namespace, "namespace", "t", "", "List Resource Namespace")
+	cmd.PersistentFlags().StringVarP(&options.namespace, "namespace", "n", "", "List Resource Namespace")
+	options.kube.AddFlags(cmd.PersistentFlags())
+	options.output.AddFlags(cmd.PersistentFlags())
 	return cmd
 }
\ No newline at end of file
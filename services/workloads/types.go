@@ -1,7 +1,7 @@
 package workloads
 
 type InitialTaskSpec struct {
-	Name 	int 	`json:name"`
-	Version string 	`json:version`
-	Path    string  `json:path`
+	Name 	int 	`json:"name"`
+	Version string 	`json:"version"`
+	Path    string  `json:"path"`
 }
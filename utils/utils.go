@@ -2,14 +2,29 @@ package utils
 
 import(
 	"errors"
-	"flag"
 	"fmt"
+
+	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
-	"path/filepath"
 )
 
+// KubeOptions defines how to connect to the kubernetes cluster
+type KubeOptions struct {
+	// Path to the kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config
+	Kubeconfig string `type:"string" required:"false"`
+
+	// The kubeconfig context to use, defaults to the current context
+	Context string `type:"string" required:"false"`
+}
+
+// AddFlags registers the kubernetes connection flags on the given flag set
+func (o *KubeOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.Kubeconfig, "kubeconfig", "", "", "(optional) absolute path to the kubeconfig file")
+	flags.StringVarP(&o.Context, "context", "", "", "(optional) the kubeconfig context to use")
+}
+
 func ValidateArgs(args []string) error {
 	if len(args) < 1 {
 		return errors.New("Invalid number of arguments for k8s apply manifest command. Use --help for details")
@@ -17,19 +32,41 @@ func ValidateArgs(args []string) error {
 	return nil
 }
 
-func K8sClient() (*kubernetes.Clientset, error) {
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+func kubeClientConfig(options *KubeOptions) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = options.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: options.Context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// K8sContext returns the name of the kubeconfig context in use
+func K8sContext(options *KubeOptions) (string, error) {
+	if options.Context != "" {
+		return options.Context, nil
 	}
-	flag.Parse()
-	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+
+	raw, err := kubeClientConfig(options).RawConfig()
+	if err != nil {
+		return "", err
+	}
+	return raw.CurrentContext, nil
+}
+
+func K8sConfig(options *KubeOptions) (*rest.Config, error) {
+	config, err := kubeClientConfig(options).ClientConfig()
 	if err != nil {
 		fmt.Println(err.Error())
 		return nil, err
 	}
+	return config, nil
+}
+
+func K8sClient(options *KubeOptions) (*kubernetes.Clientset, error) {
+	config, err := K8sConfig(options)
+	if err != nil {
+		return nil, err
+	}
 
 	c, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -38,3 +75,14 @@ func K8sClient() (*kubernetes.Clientset, error) {
 	}
 	return c, nil
 }
+
+// ExitError is returned by the commands which exit with a given code, e.g: the
+// exit code of a container, instead of the default 1.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}